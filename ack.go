@@ -0,0 +1,155 @@
+package conio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// ackSz is the size of the acknowledgement payload: kind, byte count and
+// CRC-32 (IEEE) of the received data.
+const ackSz = 1 + 8 + 4
+
+var (
+	// ErrAckMismatch is returned by ConWriter.Close if the receiving side
+	// acknowledged a different amount of data or a different digest than
+	// was sent.
+	ErrAckMismatch = errors.New("acknowledgement does not match the sent data")
+	// errInvalidAck is returned if the frame received instead of the
+	// acknowledgement is not an acknowledgement.
+	errInvalidAck = errors.New("invalid acknowledgement frame")
+)
+
+// ack is the acknowledgement of the received stream.
+type ack struct {
+	n   int64  // bytes received
+	sum uint32 // CRC-32 of the received bytes
+}
+
+// Bytes returns the serialised acknowledgement frame, including the header.
+func (a ack) Bytes() []byte {
+	var body [ackSz - 1]byte
+	endianness.PutUint64(body[0:], uint64(a.n))
+	endianness.PutUint32(body[8:], a.sum)
+	return ctlFrame(ctlAck, body[:])
+}
+
+// WriteTo writes the acknowledgement frame to w.
+func (a ack) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(a.Bytes())
+	return int64(n), err
+}
+
+// readAck reads the acknowledgement frame from r.
+func readAck(r io.Reader) (ack, error) {
+	hdr, err := readHeader(r)
+	if err != nil {
+		return ack{}, err
+	}
+	if !hdr.IsClosed() || hdr.Size() != ackSz {
+		return ack{}, errInvalidAck
+	}
+	var buf [ackSz]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return ack{}, err
+	}
+	if buf[0] != ctlAck {
+		return ack{}, errInvalidAck
+	}
+	return ack{
+		n:   int64(endianness.Uint64(buf[1:])),
+		sum: endianness.Uint32(buf[9:]),
+	}, nil
+}
+
+// NewTransferWriter creates a new ConWriter that writes the stream to rw and
+// expects the receiving side (see NewTransferReader) to acknowledge it.
+// Close blocks until the acknowledgement is received, or timeout expires.
+// Zero timeout means wait indefinitely.  Use CloseContext for finer control.
+// If the timeout expires, and rw supports read deadlines, as net.Conn does,
+// the pending read of the acknowledgement is interrupted, and the read
+// deadline is restored (see WithReadDeadline).  Otherwise the read is left
+// pending, and rw must not be read from after Close returns the error.
+func NewTransferWriter(rw io.ReadWriter, timeout time.Duration, opts ...Option) *ConWriter {
+	o := newOptions(opts)
+	w := &ConWriter{w: rw, ack: rw, timeout: timeout, crc: crc32.NewIEEE(), deadline: o.deadline}
+	w.init(o)
+	return w
+}
+
+// NewTransferReader creates a new ConReader that reads the stream from rw,
+// and, once the closed header is received, writes the acknowledgement with
+// the number of bytes received and their CRC-32 back to rw.
+func NewTransferReader(rw io.ReadWriter, opts ...Option) *ConReader {
+	r := &ConReader{r: rw, ack: rw, crc: crc32.NewIEEE()}
+	r.init(newOptions(opts))
+	return r
+}
+
+// sendAck sends the acknowledgement of the data received so far.
+func (r *ConReader) sendAck() error {
+	if _, err := (ack{n: r.n, sum: r.crc.Sum32()}).WriteTo(r.ack); err != nil {
+		return fmt.Errorf("error sending acknowledgement: %w", err)
+	}
+	return nil
+}
+
+// deadliner is implemented by net.Conn and os.File.
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// waitAck waits for the acknowledgement and verifies it against the data
+// written.  If ctx is done before the acknowledgement arrives, it returns
+// the context error.  If the ack reader supports read deadlines, the pending
+// read is interrupted, and the deadline set with WithReadDeadline is
+// restored.  Otherwise, the read is left pending:  it consumes the
+// acknowledgement, if it arrives later, or the first bytes read from the
+// connection afterwards, so the connection must not be used after the
+// error.
+func (w *ConWriter) waitAck(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("error waiting for acknowledgement: %w", err)
+	}
+	type result struct {
+		a   ack
+		err error
+	}
+	resC := make(chan result, 1)
+	go func() {
+		a, err := readAck(w.ack)
+		resC <- result{a, err}
+	}()
+	select {
+	case res := <-resC:
+		return w.checkAck(res.a, res.err)
+	case <-ctx.Done():
+		d, ok := w.ack.(deadliner)
+		if !ok {
+			return fmt.Errorf("error waiting for acknowledgement: %w", ctx.Err())
+		}
+		d.SetReadDeadline(time.Now())
+		res := <-resC
+		d.SetReadDeadline(w.deadline)
+		if res.err == nil {
+			// the acknowledgement has arrived before the interruption.
+			return w.checkAck(res.a, nil)
+		}
+		return fmt.Errorf("error waiting for acknowledgement: %w", ctx.Err())
+	}
+}
+
+// checkAck verifies the acknowledgement a, received with the error err,
+// against the data written.
+func (w *ConWriter) checkAck(a ack, err error) error {
+	if err != nil {
+		return fmt.Errorf("error receiving acknowledgement: %w", err)
+	}
+	if a.n != w.n || a.sum != w.crc.Sum32() {
+		return ErrAckMismatch
+	}
+	return nil
+}
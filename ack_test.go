@@ -0,0 +1,215 @@
+package conio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_ack_Bytes(t *testing.T) {
+	tests := []struct {
+		name string
+		a    ack
+		want []byte
+	}{
+		{"zero", ack{}, []byte{13, 0, 0, 0x80, ctlAck, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"nonzero", ack{n: 4, sum: 0xC0FFEE}, []byte{13, 0, 0, 0x80, ctlAck, 4, 0, 0, 0, 0, 0, 0, 0, 0xee, 0xff, 0xc0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("ack.Bytes() = % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readAck(t *testing.T) {
+	type args struct {
+		r io.Reader
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    ack
+		wantErr bool
+	}{
+		{"ok", args{bytes.NewReader(ack{n: 4, sum: 0xC0FFEE}.Bytes())}, ack{n: 4, sum: 0xC0FFEE}, false},
+		{"not closed", args{bytes.NewReader([]byte{13, 0, 0, 0, ctlAck, 4, 0, 0, 0, 0, 0, 0, 0, 0xee, 0xff, 0xc0, 0})}, ack{}, true},
+		{"wrong size", args{bytes.NewReader([]byte{0, 0, 0, 0x80})}, ack{}, true},
+		{"wrong kind", args{bytes.NewReader([]byte{13, 0, 0, 0x80, 0xff, 4, 0, 0, 0, 0, 0, 0, 0, 0xee, 0xff, 0xc0, 0})}, ack{}, true},
+		{"short", args{bytes.NewReader([]byte{13, 0, 0, 0x80, ctlAck, 4, 0})}, ack{}, true},
+		{"empty", args{bytes.NewReader([]byte{})}, ack{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readAck(tt.args.r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readAck() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readAck() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	data := []byte{19, 91, 9, 16, 16, 9, 19, 91}
+	tests := []struct {
+		name    string
+		recv    func(conn net.Conn) io.Reader
+		timeout time.Duration
+		wantErr error
+	}{
+		{"acknowledged",
+			func(conn net.Conn) io.Reader { return NewTransferReader(conn) },
+			time.Second,
+			nil,
+		},
+		{"not acknowledged",
+			func(conn net.Conn) io.Reader { return NewReader(conn) },
+			50 * time.Millisecond,
+			context.DeadlineExceeded,
+		},
+		{"mismatch",
+			func(conn net.Conn) io.Reader {
+				return &ConReader{r: conn, ack: conn, crc: &fakeHash{}}
+			},
+			time.Second,
+			ErrAckMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			recvC := make(chan []byte, 1)
+			go func() {
+				got, _ := ioutil.ReadAll(tt.recv(client))
+				recvC <- got
+			}()
+
+			w := NewTransferWriter(server, tt.timeout)
+			if _, err := w.Write(data); err != nil {
+				t.Fatalf("ConWriter.Write() error = %v", err)
+			}
+			if err := w.Close(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ConWriter.Close() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := <-recvC; !bytes.Equal(got, data) {
+				t.Errorf("received = % x, want % x", got, data)
+			}
+		})
+	}
+}
+
+// fakeHash is a hash that always returns 0.
+type fakeHash struct{}
+
+func (fakeHash) Write(p []byte) (int, error) { return len(p), nil }
+func (fakeHash) Sum(b []byte) []byte         { return append(b, 0, 0, 0, 0) }
+func (fakeHash) Reset()                      {}
+func (fakeHash) Size() int                   { return 4 }
+func (fakeHash) BlockSize() int              { return 1 }
+func (fakeHash) Sum32() uint32               { return 0 }
+
+func TestWithReadDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go ioutil.ReadAll(NewReader(client)) // never acknowledges
+
+	deadline := time.Now().Add(300 * time.Millisecond)
+	if err := server.SetReadDeadline(deadline); err != nil {
+		t.Fatal(err)
+	}
+	w := NewTransferWriter(server, 50*time.Millisecond, WithReadDeadline(deadline))
+	if err := w.Close(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// the deadline must be restored after the wait is interrupted.
+	errC := make(chan error, 1)
+	go func() {
+		_, err := server.Read(make([]byte, 1))
+		errC <- err
+	}()
+	select {
+	case err := <-errC:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("Read() error = %v, want %v", err, os.ErrDeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read deadline is not restored")
+	}
+}
+
+func TestConWriter_CloseContext_concurrent(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	recvC := make(chan struct{})
+	go func() {
+		ioutil.ReadAll(NewReader(client)) // never acknowledges
+		close(recvC)
+	}()
+
+	w := NewTransferWriter(server, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	closeC := make(chan error, 1)
+	go func() { closeC <- w.CloseContext(ctx) }()
+	<-recvC
+
+	// the writer waits for the acknowledgement, and must not block Write.
+	writeC := make(chan error, 1)
+	go func() {
+		_, err := w.Write([]byte("late"))
+		writeC <- err
+	}()
+	select {
+	case err := <-writeC:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("Write() error = %v, want %v", err, ErrClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Write() blocks while waiting for the acknowledgement")
+	}
+	cancel()
+	if err := <-closeC; !errors.Is(err, context.Canceled) {
+		t.Errorf("CloseContext() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestConWriter_CloseContext_noDeadline(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	// the reader does not support deadlines, and never acknowledges.
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{pr, ioutil.Discard}
+
+	w := NewTransferWriter(rw, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errC := make(chan error, 1)
+	go func() { errC <- w.CloseContext(ctx) }()
+	select {
+	case err := <-errC:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("CloseContext() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CloseContext() does not return when ctx is done")
+	}
+}
@@ -0,0 +1,200 @@
+package conio
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+// AppendFile is the file that OpenAppend can append to.  *os.File
+// implements it.
+type AppendFile interface {
+	io.ReadWriteSeeker
+	Truncate(size int64) error
+}
+
+var (
+	errAppendCompressed = errors.New("appending to the compressed stream is not supported")
+	errAppendHinted     = errors.New("appending to the stream with the size hint is not supported")
+	errAppendTrailing   = errors.New("unexpected data after the closed header")
+)
+
+// OpenAppend prepares the stream stored in f for appending, and returns the
+// ConWriter that continues it.  The stream is read from the start of f and
+// validated, and f is truncated at the end of the data:  the closed header
+// and the checksum trailer are removed, and are written again when the
+// returned writer is closed.  The index footer written by IndexWriter, if
+// any, is removed as well.  If any other data follows the closed header,
+// such as another stream, OpenAppend returns an error, and f is not
+// modified.  If the stream has no closed header, because the process
+// writing it has crashed, the partially written final frame, if any, is
+// discarded.  If f is empty, the new stream is started.
+//
+// If the stream has the checksum trailer (see WithChecksum), the checksum
+// is continued, so that it covers all data of the stream, and if it has
+// the frame checksums (see WithFrameChecksum), they are written for the new
+// frames as well.  For the non-empty f, WithChecksum, WithSizeHint and
+// WithCompression are ignored.  Streams that are compressed or have the
+// size hint can not be appended to.  The returned writer does not close f.
+func OpenAppend(f AppendFile, opts ...Option) (*ConWriter, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	st, err := scanAppend(f)
+	if err != nil {
+		return nil, fmt.Errorf("error opening stream for append: %w", err)
+	}
+	if err := f.Truncate(st.cut); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(st.cut, io.SeekStart); err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	if st.cut > 0 {
+		o.checksum, o.hinted, o.compress = false, false, false
+	}
+	w := &ConWriter{w: f}
+	w.init(o)
+	if st.cut > 0 {
+		w.n = st.n
+		if st.summed {
+			w.summed, w.crc = true, st.crc
+		}
+		w.frameSums = w.frameSums || st.frameSums
+	}
+	return w, nil
+}
+
+// appendState is the state of the existing stream.
+type appendState struct {
+	cut       int64       // offset at which the stream is continued
+	n         int64       // data bytes
+	summed    bool        // the stream has the checksum trailer
+	frameSums bool        // the stream has the frame checksums
+	frames    int         // data frames
+	crc       hash.Hash32 // CRC-32 of the data
+}
+
+// scanAppend reads the stream from r and returns the state to continue it
+// from.
+func scanAppend(r io.Reader) (appendState, error) {
+	var (
+		st      = appendState{crc: crc32.NewIEEE()}
+		off     int64
+		trailer = int64(-1) // offset of the trailer, if any
+	)
+	// cut sets the offset to continue from to off, or to the trailer.
+	cut := func(off int64) {
+		st.cut = off
+		if trailer >= 0 {
+			st.cut = trailer
+		}
+	}
+	for {
+		hdr, err := readHeader(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// no closed header, or the partial header.
+			cut(off)
+			return st, nil
+		} else if err != nil {
+			return st, err
+		}
+		size := int64(hdr.Size())
+		switch frameType(hdr) {
+		case FrameClosed:
+			cut(off)
+			return st, checkFooter(r, off+hdrSz, st.frames)
+		case FrameControl:
+			p, err := readControl(r, hdr.Size())
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				cut(off)
+				return st, nil
+			} else if err != nil {
+				return st, err
+			}
+			switch p[0] {
+			case ctlCompress:
+				return st, errAppendCompressed
+			case ctlSizeHint:
+				return st, errAppendHinted
+			case ctlChecksum:
+				if err := loadChecksum(p[1:]); err != nil {
+					return st, err
+				}
+				st.summed = true
+			case ctlTrailer:
+				if _, err := loadTrailer(p[1:]); err != nil {
+					return st, err
+				}
+				trailer = off
+			case ctlFrameSum:
+				if _, err := loadFrameSum(p[1:]); err != nil {
+					return st, err
+				}
+				st.frameSums = true
+			default:
+				return st, fmt.Errorf("%w: kind %d at offset %d", errUnknownControl, p[0], off)
+			}
+		case FrameData:
+			// the digest of the partial final frame is rolled back.
+			saved, err := st.crc.(encoding.BinaryMarshaler).MarshalBinary()
+			if err != nil {
+				return st, err
+			}
+			n, err := io.CopyN(st.crc, r, size)
+			if err == io.EOF {
+				cut(off)
+				return st, st.crc.(encoding.BinaryUnmarshaler).UnmarshalBinary(saved)
+			} else if err != nil {
+				return st, err
+			}
+			st.n += n
+			st.frames++
+		}
+		off += hdrSz + size
+	}
+}
+
+// checkFooter checks that the data read from r, that follows the closed
+// header ending at the offset end, is either absent, or the valid index
+// footer of the stream with the given number of data frames.
+func checkFooter(r io.Reader, end int64, frames int) error {
+	sz := int64(frames)*idxEntrySz + idxTailSz
+	rest, err := ioutil.ReadAll(io.LimitReader(r, sz+1))
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return nil
+	}
+	if int64(len(rest)) == sz {
+		entries, _, err := loadIndex(footerReader{p: rest, off: end}, end+sz)
+		if err == nil && len(entries) == frames {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w at offset %d", errAppendTrailing, end)
+}
+
+// footerReader is the io.ReaderAt of the data p, that is at the offset off
+// of the stream.
+type footerReader struct {
+	p   []byte
+	off int64
+}
+
+func (f footerReader) ReadAt(b []byte, off int64) (int, error) {
+	if off < f.off || off-f.off > int64(len(f.p)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.p[off-f.off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
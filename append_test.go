@@ -0,0 +1,188 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFile creates the file with the given content.
+func testFile(t *testing.T, content []byte) *os.File {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "stream.bin")
+	if err := ioutil.WriteFile(name, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// readFile reads the stream from the start of f.
+func readFile(t *testing.T, f *os.File) ([]byte, error) {
+	t.Helper()
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	return ioutil.ReadAll(NewReader(f))
+}
+
+func TestOpenAppend(t *testing.T) {
+	frames := [][]byte{[]byte("one "), []byte("two "), []byte("three ")}
+	write := func(w interface{ Write([]byte) (int, error) }) {
+		for _, p := range frames {
+			w.Write(p)
+		}
+	}
+	tests := []struct {
+		name   string
+		stream func() []byte
+		opts   []Option
+	}{
+		{"empty", func() []byte { return nil }, []Option{WithChecksum()}},
+		{"plain", func() []byte {
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			write(w)
+			w.Close()
+			return buf.Bytes()
+		}, nil},
+		{"checksum", func() []byte {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, WithChecksum())
+			write(w)
+			w.Close()
+			return buf.Bytes()
+		}, nil},
+		{"indexed", func() []byte {
+			var buf bytes.Buffer
+			w := NewIndexWriter(&buf, WithChecksum())
+			write(w)
+			w.Close()
+			return buf.Bytes()
+		}, []Option{WithSizeHint(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := tt.stream()
+			var want []byte
+			if len(stream) > 0 {
+				want = bytes.Join(frames, nil)
+			}
+			f := testFile(t, stream)
+			// appending twice, to check that the trailer is continued.
+			for _, more := range []string{"four ", "five"} {
+				w, err := OpenAppend(f, tt.opts...)
+				if err != nil {
+					t.Fatalf("OpenAppend() error = %v", err)
+				}
+				if _, err := w.Write([]byte(more)); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				want = append(want, more...)
+			}
+			got, err := readFile(t, f)
+			if err != nil {
+				t.Fatalf("ConReader.Read() error = %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("data = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestOpenAppend_crash checks that the stream truncated at any offset, as
+// if the writing process has crashed, can be appended to, and retains all
+// complete frames.
+func TestOpenAppend_crash(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithChecksum())
+	frames := []string{"alpha", "beta", "gamma"}
+	var ends []int // stream offsets of the data frame ends
+	for _, p := range frames {
+		w.Write([]byte(p))
+		ends = append(ends, buf.Len())
+	}
+	w.Close()
+	stream := buf.Bytes()
+
+	for cut := 0; cut <= len(stream); cut++ {
+		var want string
+		for i, end := range ends {
+			if end <= cut {
+				want += frames[i]
+			}
+		}
+		f := testFile(t, stream[:cut])
+		w, err := OpenAppend(f)
+		if err != nil {
+			t.Fatalf("cut %d: OpenAppend() error = %v", cut, err)
+		}
+		w.Write([]byte("+more"))
+		if err := w.Close(); err != nil {
+			t.Fatalf("cut %d: Close() error = %v", cut, err)
+		}
+		got, err := readFile(t, f)
+		if err != nil {
+			t.Errorf("cut %d: ConReader.Read() error = %v", cut, err)
+		}
+		if string(got) != want+"+more" {
+			t.Errorf("cut %d: data = %q, want %q", cut, got, want+"+more")
+		}
+	}
+}
+
+func TestOpenAppend_errors(t *testing.T) {
+	stream := func(opts ...Option) []byte {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, opts...)
+		w.Write([]byte("data"))
+		w.Close()
+		return buf.Bytes()
+	}
+	// badIndex is the indexed stream with the corrupted index entry.
+	badIndex := func() []byte {
+		var buf bytes.Buffer
+		w := NewIndexWriter(&buf)
+		w.Write([]byte("data"))
+		w.Close()
+		p := buf.Bytes()
+		p[len(p)-idxTailSz-1] ^= 1
+		return p
+	}
+	tests := []struct {
+		name    string
+		stream  []byte
+		wantErr error
+	}{
+		{"compressed", stream(WithCompression(flate.BestSpeed)), errAppendCompressed},
+		{"hinted", stream(WithSizeHint(4)), errAppendHinted},
+		{"unknown control", ctlFrame(0x7f, nil), errUnknownControl},
+		{"multiple streams", append(stream(), stream()...), errAppendTrailing},
+		{"trailing data", append(stream(), "junk"...), errAppendTrailing},
+		{"invalid index", badIndex(), errAppendTrailing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testFile(t, tt.stream)
+			if _, err := OpenAppend(f); !errors.Is(err, tt.wantErr) {
+				t.Errorf("OpenAppend() error = %v, want %v", err, tt.wantErr)
+			}
+			// the file is not modified.
+			if fi, _ := f.Stat(); fi.Size() != int64(len(tt.stream)) {
+				t.Errorf("file size = %d, want %d", fi.Size(), len(tt.stream))
+			}
+		})
+	}
+}
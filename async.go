@@ -0,0 +1,100 @@
+package conio
+
+import (
+	"fmt"
+	"sync"
+)
+
+// asyncWriter writes the frames of ConWriter in background.
+type asyncWriter struct {
+	w *ConWriter
+
+	mu    sync.RWMutex // guards sends to queue against it being closed
+	queue chan asyncItem
+	done  chan struct{} // closed when the writer goroutine exits
+	pool  sync.Pool     // *[]byte
+}
+
+// asyncItem is the queue item.  It is either a frame payload, or a flush
+// marker.
+type asyncItem struct {
+	buf   *[]byte       // pooled frame payload
+	flush chan struct{} // closed once all preceding frames are written
+}
+
+func newAsyncWriter(w *ConWriter, depth int) *asyncWriter {
+	a := &asyncWriter{
+		w:     w,
+		queue: make(chan asyncItem, depth),
+		done:  make(chan struct{}),
+	}
+	a.pool.New = func() interface{} { return new([]byte) }
+	go a.run()
+	return a
+}
+
+// run writes the queued frames to the underlying writer.  After the first
+// error, the remaining frames are discarded.
+func (a *asyncWriter) run() {
+	defer close(a.done)
+	for item := range a.queue {
+		if item.flush != nil {
+			close(item.flush)
+			continue
+		}
+		p := *item.buf
+		perr := a.w.pace(len(p))
+		a.w.mu.Lock()
+		if a.w.err == nil {
+			if perr != nil {
+				a.w.err = perr
+			} else {
+				n, err := a.w.writeFrame(must(newBinHeader(len(p), false)), p)
+				a.w.account(p[:n])
+				if err != nil {
+					a.w.err = fmt.Errorf("deferred write error: %w", err)
+				}
+			}
+		}
+		a.w.mu.Unlock()
+		a.pool.Put(item.buf)
+	}
+}
+
+// write copies p into a pooled buffer and queues it.
+func (a *asyncWriter) write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if err := a.w.check(); err != nil {
+		return 0, err
+	}
+	buf := a.pool.Get().(*[]byte)
+	*buf = append((*buf)[:0], p...)
+	a.queue <- asyncItem{buf: buf}
+	return len(p), nil
+}
+
+// flush waits for the queued frames to be written.
+func (a *asyncWriter) flush() error {
+	a.mu.RLock()
+	if err := a.w.check(); err != nil {
+		a.mu.RUnlock()
+		return err
+	}
+	flushed := make(chan struct{})
+	a.queue <- asyncItem{flush: flushed}
+	a.mu.RUnlock()
+
+	<-flushed
+	a.w.mu.Lock()
+	defer a.w.mu.Unlock()
+	return a.w.err
+}
+
+// close closes the queue and waits for the queued frames to be written.
+func (a *asyncWriter) close() {
+	a.mu.Lock()
+	close(a.queue)
+	a.mu.Unlock()
+	<-a.done
+}
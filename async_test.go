@@ -0,0 +1,91 @@
+package conio
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestConWriter_async(t *testing.T) {
+	var buf syncBuffer
+	w := NewWriter(&buf, WithAsync(4))
+
+	var want []byte
+	p := make([]byte, 100)
+	for i := 0; i < 50; i++ {
+		for j := range p {
+			p[j] = byte(i)
+		}
+		if _, err := w.Write(p); err != nil {
+			t.Fatalf("ConWriter.Write() error = %v", err)
+		}
+		want = append(want, p...) // p is reused by the next iteration
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("ConWriter.Flush() error = %v", err)
+	}
+	if got, want := len(buf.Bytes()), 50*(hdrSz+100); got != want {
+		t.Errorf("flushed %d bytes, want %d", got, want)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ConWriter.Close() error = %v", err)
+	}
+
+	got, err := ioutil.ReadAll(NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatalf("ConReader.Read() error = %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("ConReader.Read() = % x, want % x", got, want)
+	}
+}
+
+func TestConWriter_asyncError(t *testing.T) {
+	errWrite := errors.New("write failed")
+	w := NewWriter(&errWriter{err: errWrite}, WithAsync(4))
+	if _, err := w.Write([]byte{1, 2, 3}); err != nil {
+		t.Fatalf("ConWriter.Write() error = %v, want nil", err)
+	}
+	if err := w.Flush(); !errors.Is(err, errWrite) {
+		t.Errorf("ConWriter.Flush() error = %v, want %v", err, errWrite)
+	}
+	if _, err := w.Write([]byte{1, 2, 3}); !errors.Is(err, errWrite) {
+		t.Errorf("ConWriter.Write() error = %v, want %v", err, errWrite)
+	}
+	if err := w.Close(); !errors.Is(err, errWrite) {
+		t.Errorf("ConWriter.Close() error = %v, want %v", err, errWrite)
+	}
+	if err := w.Flush(); err != ErrClosed {
+		t.Errorf("ConWriter.Flush() error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestConWriter_asyncCloseDrains(t *testing.T) {
+	var buf syncBuffer
+	w := NewWriter(&buf, WithAsync(1))
+	for i := 0; i < 10; i++ {
+		if _, err := w.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("ConWriter.Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ConWriter.Close() error = %v", err)
+	}
+	got, err := ioutil.ReadAll(NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatalf("ConReader.Read() error = %v", err)
+	}
+	if want := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !bytes.Equal(got, want) {
+		t.Errorf("ConReader.Read() = % x, want % x", got, want)
+	}
+}
+
+// errWriter fails every write with err.
+type errWriter struct {
+	err error
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
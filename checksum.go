@@ -0,0 +1,115 @@
+package conio
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// checksum algorithms.
+const (
+	algCRC32 byte = iota + 1 // CRC-32, IEEE polynomial
+)
+
+// ErrChecksum is returned by ConReader if the data received does not match
+// the trailer sent by the writer created with WithChecksum, or if the
+// trailer is missing, and if the data frame does not match the frame
+// checksum sent by the writer created with WithFrameChecksum.
+var ErrChecksum = errors.New("stream checksum mismatch")
+
+// checksumFrame returns the serialised control frame that announces the
+// checksum trailer.
+func checksumFrame() []byte {
+	return ctlFrame(ctlChecksum, []byte{algCRC32})
+}
+
+// loadChecksum validates the checksum announcement body.
+func loadChecksum(p []byte) error {
+	if len(p) != 1 {
+		return fmt.Errorf("%w: checksum", errInvalidControl)
+	}
+	if p[0] != algCRC32 {
+		return fmt.Errorf("%w: unsupported checksum algorithm %d", errInvalidControl, p[0])
+	}
+	return nil
+}
+
+// trailerFrame returns the serialised trailer control frame with the number
+// of bytes sent and their checksum.  The body is the same as the body of
+// the acknowledgement.
+func trailerFrame(t ack) []byte {
+	var body [ackSz - 1]byte
+	endianness.PutUint64(body[0:], uint64(t.n))
+	endianness.PutUint32(body[8:], t.sum)
+	return ctlFrame(ctlTrailer, body[:])
+}
+
+// loadTrailer loads the trailer from the control frame body.
+func loadTrailer(p []byte) (ack, error) {
+	if len(p) != ackSz-1 {
+		return ack{}, fmt.Errorf("%w: trailer", errInvalidControl)
+	}
+	return ack{
+		n:   int64(endianness.Uint64(p[0:])),
+		sum: endianness.Uint32(p[8:]),
+	}, nil
+}
+
+// frameSumSz is the size of the frame checksum control frame.
+const frameSumSz = hdrSz + 1 + 4
+
+// frameSumFrame returns the serialised control frame with the checksum of
+// the data frame payload p.
+func frameSumFrame(p []byte) []byte {
+	var body [4]byte
+	endianness.PutUint32(body[:], crc32.ChecksumIEEE(p))
+	return ctlFrame(ctlFrameSum, body[:])
+}
+
+// loadFrameSum loads the frame checksum from the control frame body.
+func loadFrameSum(p []byte) (uint32, error) {
+	if len(p) != 4 {
+		return 0, fmt.Errorf("%w: frame checksum", errInvalidControl)
+	}
+	return endianness.Uint32(p), nil
+}
+
+// sumData starts computing the checksum of the data received, unless it is
+// computed already.
+func (r *ConReader) sumData() {
+	r.summed = true
+	if r.crc == nil {
+		r.crc = crc32.NewIEEE()
+	}
+}
+
+// checkTrailer verifies the data received against the trailer.
+func (r *ConReader) checkTrailer() error {
+	if r.trailer == nil {
+		if r.summed {
+			return fmt.Errorf("%w: trailer is missing", ErrChecksum)
+		}
+		return nil
+	}
+	if r.trailer.n != r.n {
+		return fmt.Errorf("%w: received %d bytes, trailer declares %d", ErrChecksum, r.n, r.trailer.n)
+	}
+	if r.summed && r.trailer.sum != r.crc.Sum32() {
+		return fmt.Errorf("%w: crc32 %08x, trailer declares %08x", ErrChecksum, r.crc.Sum32(), r.trailer.sum)
+	}
+	return nil
+}
+
+// checkFrameSum verifies the payload of the data frame that precedes the
+// frame checksum against sum.  The checksum that does not follow the data
+// frame, or follows the frame that has not been read in order, is skipped.
+func (r *ConReader) checkFrameSum(sum uint32) error {
+	if !r.summable || r.seeked {
+		return nil
+	}
+	r.summable = false
+	if sum != r.frameSum {
+		return fmt.Errorf("%w: frame at offset %d: crc32 %08x, frame checksum declares %08x", ErrChecksum, r.frameOff, r.frameSum, sum)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestWithChecksum(t *testing.T) {
+	data := []byte("0123456789")
+	trailer := func(n int64, sum uint32) []byte {
+		return trailerFrame(ack{n: n, sum: sum})
+	}
+	closed := must(newBinHeader(0, true)).Bytes()
+	frame := append(must(newBinHeader(len(data), false)).Bytes(), data...)
+	cat := func(pp ...[]byte) []byte { return bytes.Join(pp, nil) }
+	tests := []struct {
+		name    string
+		stream  func() []byte
+		opts    []Option
+		wantErr error
+	}{
+		{"ok", func() []byte {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, WithChecksum())
+			w.Write(data[:4])
+			w.Write(data[4:])
+			w.Close()
+			return buf.Bytes()
+		}, nil, nil},
+		{"ok compressed", func() []byte {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, WithChecksum(), WithCompression(flate.BestSpeed))
+			w.Write(data)
+			w.Close()
+			return buf.Bytes()
+		}, nil, nil},
+		{"ok frame checksums", func() []byte {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, WithChecksum(), WithFrameChecksum(), WithCompression(flate.BestSpeed))
+			w.Write(data)
+			w.Close()
+			return buf.Bytes()
+		}, nil, nil},
+		{"ok prefetch", func() []byte {
+			return cat(checksumFrame(), frame, trailer(10, 0xa684c7c6), closed)
+		}, []Option{WithPrefetch(2, 0)}, nil},
+		{"wrong sum", func() []byte {
+			return cat(checksumFrame(), frame, trailer(10, 0), closed)
+		}, nil, ErrChecksum},
+		{"wrong size", func() []byte {
+			return cat(checksumFrame(), frame, trailer(9, 0xa684c7c6), closed)
+		}, nil, ErrChecksum},
+		{"missing trailer", func() []byte {
+			return cat(checksumFrame(), frame, closed)
+		}, nil, ErrChecksum},
+		{"trailer only", func() []byte {
+			return cat(frame, trailer(10, 0), closed)
+		}, nil, nil},
+		{"duplicate trailer", func() []byte {
+			return cat(checksumFrame(), frame, trailer(10, 0xa684c7c6), trailer(10, 0xa684c7c6), closed)
+		}, nil, errInvalidControl},
+		{"ok frame checksum prefetch", func() []byte {
+			return cat(frame, frameSumFrame(data), closed)
+		}, []Option{WithPrefetch(2, 0)}, nil},
+		{"wrong frame checksum", func() []byte {
+			return cat(frame, frameSumFrame([]byte("0123456788")), closed)
+		}, nil, ErrChecksum},
+		{"wrong frame checksum prefetch", func() []byte {
+			return cat(frame, frameSumFrame([]byte("0123456788")), closed)
+		}, []Option{WithPrefetch(2, 0)}, ErrChecksum},
+		{"frame checksum without frame", func() []byte {
+			return cat(frameSumFrame([]byte("x")), frame, closed)
+		}, nil, nil},
+		{"invalid algorithm", func() []byte {
+			return cat(ctlFrame(ctlChecksum, []byte{0xff}), frame, closed)
+		}, nil, errInvalidControl},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(bytes.NewReader(tt.stream()), tt.opts...)
+			defer r.Close()
+			got, err := ioutil.ReadAll(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ConReader.Read() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(got, data) {
+				t.Errorf("ConReader.Read() = %q, want %q", got, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rusq/conio"
+)
+
+// runCat writes the data of the stream to the output.
+func runCat(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("cat")
+	var (
+		output  = fs.String("o", "-", "output `file`")
+		salvage = fs.Bool("recover", false, "extract the intact frames of the damaged stream, and report the damage")
+		multi   = fs.Bool("multistream", false, "extract the data of all concatenated streams")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	name, err := inputName(fs)
+	if err != nil {
+		return err
+	}
+	out, err := createOutput(*output, stdout)
+	if err != nil {
+		return err
+	}
+	if *salvage {
+		err = catRecover(out, name, stdin)
+	} else {
+		err = cat(out, name, stdin, *multi)
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func cat(out io.Writer, name string, stdin io.Reader, multi bool) error {
+	in, err := openInput(name, stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r := conio.NewReader(in)
+	defer r.Close()
+	r.Multistream(multi)
+	_, err = io.Copy(out, r)
+	return err
+}
+
+// catRecover extracts the intact frames with RecoveryReader, and reports
+// the damaged regions to stderr.
+func catRecover(out io.Writer, name string, stdin io.Reader) error {
+	in, err := openSeekable(name, stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	size, err := in.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	r := conio.NewRecoveryReader(in, size)
+	if _, err := io.Copy(out, r); err != nil {
+		return err
+	}
+	for _, d := range r.Damage() {
+		fmt.Fprintf(os.Stderr, "damaged: %s\n", d)
+	}
+	return nil
+}
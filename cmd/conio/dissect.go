@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+
+	"github.com/rusq/conio"
+)
+
+// runDissect writes the annotated hex dump of the stream.
+func runDissect(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("dissect")
+	limit := fs.Int("limit", 256, "dump at most `n` bytes of each payload, 0 means no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	name, err := inputName(fs)
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name, stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	d, err := conio.Dissect(in, *limit)
+	if err != nil {
+		return err
+	}
+	if err := d.Dump(stdout); err != nil {
+		return err
+	}
+	if d.Err != nil {
+		return d.Err
+	}
+	return nil
+}
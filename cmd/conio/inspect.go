@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/rusq/conio"
+)
+
+// runInspect lists the frames of the stream.  In JSON mode, each frame is
+// written as a separate JSON object on its own line.
+func runInspect(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("inspect")
+	asJSON := fs.Bool("json", false, "output frames as JSON, one object per line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	name, err := inputName(fs)
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name, stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var emit func(conio.Frame) error
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		emit = func(f conio.Frame) error { return enc.Encode(f) }
+	} else {
+		tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+		defer tw.Flush()
+		fmt.Fprintln(tw, "INDEX\tOFFSET\tSIZE\tFLAGS\tTYPE\tDETAIL")
+		emit = func(f conio.Frame) error {
+			_, err := fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%s\t%s\n", f.Index, f.Offset, f.Size, flags(f), f.Type, detail(f))
+			return err
+		}
+	}
+
+	s := conio.NewFrameScanner(in)
+	for {
+		f, err := s.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			// the frame cut in the middle is listed before the error.
+			if f.Size > 0 || f.Offset > 0 {
+				emit(f)
+			}
+			return err
+		}
+		if err := emit(f); err != nil {
+			return err
+		}
+	}
+}
+
+// flags returns the header flags of the frame in the textual form.
+func flags(f conio.Frame) string {
+	if f.Closed {
+		return "C"
+	}
+	return "-"
+}
+
+// detail returns the control frame description in the textual form.
+func detail(f conio.Frame) string {
+	if f.Kind == "" {
+		return ""
+	}
+	return f.Kind + " " + f.Detail
+}
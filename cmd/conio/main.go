@@ -0,0 +1,136 @@
+// Command conio inspects, verifies, extracts and creates conio streams.
+//
+// Usage:
+//
+//	conio inspect [-json] [file]             list the frames of the stream
+//	conio dissect [-limit n] [file]          dump the stream in annotated hex
+//	conio cat [flags] [-o output] [file]     extract the data of the stream
+//	conio verify [-json] [file]              check the structure and the checksum
+//	conio wrap [flags] [-o output] [file]    frame the input into the stream
+//
+// If the file is not given, or is "-", the standard input is used.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// command is the subcommand.
+type command struct {
+	name  string
+	short string
+	run   func(args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"inspect", "list the frames of the stream", runInspect},
+	{"dissect", "dump the stream in annotated hex", runDissect},
+	{"cat", "extract the data of the stream", runCat},
+	{"verify", "check the structure and the checksum of the stream", runVerify},
+	{"wrap", "frame the input into the stream", runWrap},
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(flag.Args()[1:], os.Stdin, os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "conio %s: %s\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "conio: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s <command> [flags] [file]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-8s %s\n", c.name, c.short)
+	}
+	fmt.Fprintf(flag.CommandLine.Output(), "\nRun %s <command> -h for the command flags.\n", os.Args[0])
+}
+
+// newFlagSet returns the flag set for the command.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: conio %s [flags] [file]\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// inputName returns the input file name from the command arguments.
+func inputName(fs *flag.FlagSet) (string, error) {
+	switch fs.NArg() {
+	case 0:
+		return "-", nil
+	case 1:
+		return fs.Arg(0), nil
+	}
+	return "", fmt.Errorf("too many arguments")
+}
+
+// openInput opens the input file, or returns stdin if name is "-".
+func openInput(name string, stdin io.Reader) (io.ReadCloser, error) {
+	if name == "-" {
+		return ioutil.NopCloser(stdin), nil
+	}
+	return os.Open(name)
+}
+
+// readSeekCloser is the input that can be read more than once, or at
+// random.
+type readSeekCloser interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+}
+
+// openSeekable opens the input file.  The standard input is read into
+// memory, as it can not be rewound.
+func openSeekable(name string, stdin io.Reader) (readSeekCloser, error) {
+	if name == "-" {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		return nopSeekCloser{bytes.NewReader(data)}, nil
+	}
+	return os.Open(name)
+}
+
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+// createOutput creates the output file, or returns stdout if name is "-".
+func createOutput(name string, stdout io.Writer) (io.WriteCloser, error) {
+	if name == "-" {
+		return nopWriteCloser{stdout}, nil
+	}
+	return os.Create(name)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
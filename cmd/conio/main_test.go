@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	tests := []struct {
+		name       string
+		args       []string
+		wantFrames int64
+	}{
+		{"plain", []string{"-size", "3000"}, 4},
+		{"compressed", []string{"-z", "1"}, 1},
+		{"no checksum", []string{"-checksum=false"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stream bytes.Buffer
+			if err := runWrap(tt.args, bytes.NewReader(data), &stream); err != nil {
+				t.Fatalf("wrap: %v", err)
+			}
+
+			var out bytes.Buffer
+			if err := runVerify([]string{"-json"}, bytes.NewReader(stream.Bytes()), &out); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			var rep report
+			if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+				t.Fatal(err)
+			}
+			if !rep.OK || rep.Frames != tt.wantFrames || rep.Bytes != int64(len(data)) {
+				t.Errorf("verify report = %+v", rep)
+			}
+
+			out.Reset()
+			if err := runInspect([]string{"-json"}, bytes.NewReader(stream.Bytes()), &out); err != nil {
+				t.Fatalf("inspect: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if !strings.Contains(lines[len(lines)-1], `"type":"closed"`) {
+				t.Errorf("inspect last frame = %s, want closed", lines[len(lines)-1])
+			}
+
+			out.Reset()
+			if err := runCat(nil, bytes.NewReader(stream.Bytes()), &out); err != nil {
+				t.Fatalf("cat: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), data) {
+				t.Error("cat output does not match the input")
+			}
+		})
+	}
+}
+
+func TestVerify_invalid(t *testing.T) {
+	var stream bytes.Buffer
+	if err := runWrap([]string{"-size", "10"}, strings.NewReader("0123456789abcdef"), &stream); err != nil {
+		t.Fatal(err)
+	}
+	valid := stream.Bytes()
+	corrupt := append([]byte(nil), valid...)
+	corrupt[bytes.Index(corrupt, []byte("abc"))] = 'x'
+	var summed bytes.Buffer
+	if err := runWrap([]string{"-size", "10", "-checksum=false", "-frame-checksum"}, strings.NewReader("0123456789abcdef"), &summed); err != nil {
+		t.Fatal(err)
+	}
+	corruptFrame := summed.Bytes()
+	corruptFrame[bytes.Index(corruptFrame, []byte("abc"))] = 'x'
+
+	tests := []struct {
+		name         string
+		input        []byte
+		wantOK       bool
+		wantError    string
+		wantTrailing int64
+	}{
+		{"trailing data", append(append([]byte(nil), valid...), "garbage"...), true, "", 7},
+		{"truncated", valid[:len(valid)-10], false, "unexpected EOF", 0},
+		{"corrupt", corrupt, false, "checksum mismatch", 0},
+		{"corrupt frame", corruptFrame, false, "frame checksum declares", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runVerify([]string{"-json"}, bytes.NewReader(tt.input), &out)
+			if (err == nil) != tt.wantOK || (err != nil && !errors.Is(err, errInvalid)) {
+				t.Fatalf("verify error = %v, want ok %v", err, tt.wantOK)
+			}
+			var rep report
+			if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(rep.Error, tt.wantError) {
+				t.Errorf("verify error = %q, want %q", rep.Error, tt.wantError)
+			}
+			if rep.Trailing != tt.wantTrailing {
+				t.Errorf("trailing = %d, want %d", rep.Trailing, tt.wantTrailing)
+			}
+		})
+	}
+}
+
+func TestDissect(t *testing.T) {
+	var stream bytes.Buffer
+	if err := runWrap([]string{"-checksum=false"}, strings.NewReader("hello"), &stream); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := runDissect(nil, bytes.NewReader(stream.Bytes()), &out); err != nil {
+		t.Fatalf("dissect: %v", err)
+	}
+	if !strings.Contains(out.String(), "|hello") {
+		t.Errorf("dissect output does not contain the payload:\n%s", out.String())
+	}
+
+	out.Reset()
+	err := runDissect(nil, bytes.NewReader(stream.Bytes()[:6]), &out)
+	if err == nil || !strings.Contains(out.String(), "error     expected payload of 5 bytes, got 2") {
+		t.Errorf("dissect error = %v, output:\n%s", err, out.String())
+	}
+}
+
+func TestInspect_truncated(t *testing.T) {
+	var stream bytes.Buffer
+	if err := runWrap([]string{"-checksum=false"}, strings.NewReader("hello"), &stream); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err := runInspect([]string{"-json"}, bytes.NewReader(stream.Bytes()[:6]), &out)
+	if err == nil {
+		t.Fatal("inspect of the truncated stream succeeded")
+	}
+	if !strings.Contains(out.String(), `"size":5`) {
+		t.Errorf("inspect output does not list the incomplete frame:\n%s", out.String())
+	}
+}
+
+func TestCatRecover(t *testing.T) {
+	var stream bytes.Buffer
+	if err := runWrap([]string{"-size", "10", "-frame-checksum"}, strings.NewReader("aaaaaaaaaabbbbbbbbbbcccccccccc"), &stream); err != nil {
+		t.Fatal(err)
+	}
+	damaged := stream.Bytes()
+	damaged[bytes.Index(damaged, []byte("bbb"))] = 'x'
+	var out bytes.Buffer
+	if err := runCat([]string{"-recover"}, bytes.NewReader(damaged), &out); err != nil {
+		t.Fatalf("cat: %v", err)
+	}
+	if want := "aaaaaaaaaacccccccccc"; out.String() != want {
+		t.Errorf("cat -recover = %q, want %q", out.String(), want)
+	}
+}
+
+func TestCatMultistream(t *testing.T) {
+	var stream bytes.Buffer
+	for _, s := range []string{"one ", "two"} {
+		if err := runWrap(nil, strings.NewReader(s), &stream); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if err := runCat([]string{"-multistream"}, bytes.NewReader(stream.Bytes()), &out); err != nil {
+		t.Fatalf("cat: %v", err)
+	}
+	if want := "one two"; out.String() != want {
+		t.Errorf("cat -multistream = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/rusq/conio"
+)
+
+// report is the result of the stream verification.
+type report struct {
+	OK           bool   `json:"ok"`
+	Frames       int64  `json:"frames"`        // data frames
+	Heartbeats   int64  `json:"heartbeats"`    // heartbeat frames
+	Controls     int64  `json:"controls"`      // control frames
+	Bytes        int64  `json:"bytes"`         // data bytes, decompressed
+	Size         int64  `json:"size"`          // size of the stream
+	ExpectedSize int64  `json:"expected_size"` // declared data size, or -1
+	Compressed   bool   `json:"compressed"`
+	Checksum     bool   `json:"checksum"`       // the trailer is verified
+	Trailing     int64  `json:"trailing_bytes"` // bytes after the closed header
+	Error        string `json:"error,omitempty"`
+}
+
+// errInvalid is returned by verify if the stream is invalid.
+var errInvalid = errors.New("stream is invalid")
+
+// runVerify checks the structure of the stream, the size hint and the
+// checksum trailer, if present.  The stream must end with the closed
+// header, and all control frames must be known and valid.  The data that
+// follows the closed header is reported, but is not an error.
+func runVerify(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("verify")
+	asJSON := fs.Bool("json", false, "output the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	name, err := inputName(fs)
+	if err != nil {
+		return err
+	}
+	in, err := openSeekable(name, stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	rep, err := verify(in)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if err := json.NewEncoder(stdout).Encode(rep); err != nil {
+			return err
+		}
+	} else {
+		printReport(stdout, rep)
+	}
+	if !rep.OK {
+		return errInvalid
+	}
+	return nil
+}
+
+// verify verifies the stream in two passes:  the first one checks the
+// structure of the stream, and the second one reads the data.
+func verify(in io.ReadSeeker) (report, error) {
+	rep := report{ExpectedSize: -1}
+	var (
+		s      = conio.NewFrameScanner(in)
+		closed bool
+	)
+	for !closed {
+		f, err := s.Next()
+		if err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("closed header is missing at offset %d", s.Offset())
+			}
+			rep.Error = err.Error()
+			return rep, nil
+		}
+		switch f.Type {
+		case conio.FrameClosed:
+			closed = true
+		case conio.FrameControl:
+			switch f.Kind {
+			case "compress":
+				rep.Compressed = true
+			case "trailer":
+				rep.Checksum = true
+			case "unknown":
+				rep.Error = fmt.Sprintf("frame %d at offset %d: %s", f.Index, f.Offset, f.Detail)
+				return rep, nil
+			}
+		}
+	}
+	rep.Size = s.Offset()
+	end, err := in.Seek(0, io.SeekEnd)
+	if err != nil {
+		return rep, err
+	}
+	rep.Trailing = end - rep.Size
+
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return rep, err
+	}
+	r := conio.NewReader(in)
+	defer r.Close()
+	rep.Bytes, err = io.Copy(ioutil.Discard, r)
+	st := r.Stats()
+	rep.Frames, rep.Heartbeats, rep.Controls = st.Frames, st.Heartbeats, st.Controls
+	rep.ExpectedSize = r.ExpectedSize()
+	if err != nil {
+		rep.Error = err.Error()
+		return rep, nil
+	}
+	rep.OK = true
+	return rep, nil
+}
+
+func printReport(w io.Writer, rep report) {
+	status := "OK"
+	if !rep.OK {
+		status = "INVALID: " + rep.Error
+	}
+	fmt.Fprintf(w, "status:      %s\n", status)
+	fmt.Fprintf(w, "frames:      %d data, %d heartbeat, %d control\n", rep.Frames, rep.Heartbeats, rep.Controls)
+	fmt.Fprintf(w, "data:        %d bytes\n", rep.Bytes)
+	if rep.ExpectedSize >= 0 {
+		fmt.Fprintf(w, "declared:    %d bytes\n", rep.ExpectedSize)
+	}
+	fmt.Fprintf(w, "stream:      %d bytes\n", rep.Size)
+	fmt.Fprintf(w, "compressed:  %t\n", rep.Compressed)
+	fmt.Fprintf(w, "checksum:    %t\n", rep.Checksum)
+	if rep.Trailing > 0 {
+		fmt.Fprintf(w, "trailing:    %d bytes after the closed header\n", rep.Trailing)
+	}
+}
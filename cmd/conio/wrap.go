@@ -0,0 +1,82 @@
+package main
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rusq/conio"
+)
+
+// runWrap frames the input into the stream.
+func runWrap(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("wrap")
+	var (
+		output   = fs.String("o", "-", "output `file`")
+		size     = fs.Int("size", 32<<10, "data frame `size`, for the uncompressed stream")
+		level    = fs.Int("z", flate.NoCompression, "compression `level`, 0 means no compression")
+		checksum = fs.Bool("checksum", true, "end the stream with the checksum trailer")
+		frameSum = fs.Bool("frame-checksum", false, "follow each frame with its checksum, verified by the reader and used for recovery")
+		hint     = fs.Bool("hint", true, "declare the size of the data, if the input is a regular file")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *size <= 0 {
+		return fmt.Errorf("invalid frame size: %d", *size)
+	}
+	name, err := inputName(fs)
+	if err != nil {
+		return err
+	}
+	in, err := openInput(name, stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput(*output, stdout)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var opts []conio.Option
+	if *level != flate.NoCompression {
+		opts = append(opts, conio.WithCompression(*level))
+	}
+	if *checksum {
+		opts = append(opts, conio.WithChecksum())
+	}
+	if *frameSum {
+		opts = append(opts, conio.WithFrameChecksum())
+	}
+	if f, ok := in.(*os.File); ok && *hint {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			opts = append(opts, conio.WithSizeHint(fi.Size()))
+		}
+	}
+
+	w := conio.NewWriter(out, opts...)
+	buf := make([]byte, *size)
+	for {
+		n, err := io.ReadFull(in, buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				w.Close()
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil {
+			w.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,241 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// compression algorithms.
+const (
+	algDeflate byte = iota + 1 // raw deflate, RFC 1951
+)
+
+// defaultBlockSz is the size of the uncompressed block that is compressed
+// into a single frame.
+const defaultBlockSz = 1 << 20
+
+var errBlockSize = errors.New("decompressed block exceeds the declared block size")
+
+// codec describes the compression of the data frames.  Each data frame is
+// compressed independently, which allows to compress and decompress frames
+// in parallel.
+type codec struct {
+	alg     byte
+	blockSz int // maximum size of the uncompressed block
+}
+
+// Bytes returns the serialised codec control frame.
+func (c *codec) Bytes() []byte {
+	var body [5]byte
+	body[0] = c.alg
+	endianness.PutUint32(body[1:], uint32(c.blockSz))
+	return ctlFrame(ctlCompress, body[:])
+}
+
+// loadCodec loads the codec from the control frame body.
+func loadCodec(p []byte) (*codec, error) {
+	if len(p) != 5 {
+		return nil, fmt.Errorf("%w: compression", errInvalidControl)
+	}
+	c := &codec{alg: p[0], blockSz: int(endianness.Uint32(p[1:]))}
+	if c.alg != algDeflate {
+		return nil, fmt.Errorf("%w: unsupported compression algorithm %d", errInvalidControl, c.alg)
+	}
+	if c.blockSz <= 0 || maxSz < c.blockSz {
+		return nil, fmt.Errorf("%w: compression block size %d", errInvalidControl, c.blockSz)
+	}
+	return c, nil
+}
+
+// inflater decompresses the frames.  It is not safe for concurrent use.
+type inflater struct {
+	br bytes.Reader
+	fr io.ReadCloser
+}
+
+// decode decompresses src, appending it to dst[:0], and returns the result.
+// It fails if the decompressed data is larger than limit.
+func (d *inflater) decode(dst, src []byte, limit int) ([]byte, error) {
+	d.br.Reset(src)
+	if d.fr == nil {
+		d.fr = flate.NewReader(&d.br)
+	} else if err := d.fr.(flate.Resetter).Reset(&d.br, nil); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(dst[:0])
+	n, err := buf.ReadFrom(io.LimitReader(d.fr, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing frame: %w", err)
+	}
+	if n > int64(limit) {
+		return nil, errBlockSize
+	}
+	return buf.Bytes(), nil
+}
+
+// compressor compresses the data written to ConWriter in blocks on several
+// workers, and writes the compressed frames in order.
+type compressor struct {
+	w     *ConWriter
+	codec *codec
+	level int
+
+	mu  sync.Mutex // guards buf and sends to the channels
+	buf *[]byte    // current block
+
+	jobs    chan *cjob     // blocks for workers
+	order   chan *cjob     // blocks in stream order
+	workers sync.WaitGroup //
+	done    chan struct{}  // closed when the emitter exits
+	pool    sync.Pool      // *[]byte
+}
+
+// cjob is the block being compressed, or the flush marker.
+type cjob struct {
+	in    *[]byte
+	out   bytes.Buffer
+	err   error
+	ready chan struct{} // closed when out is ready
+	flush chan struct{} // if set, closed when all preceding blocks are written
+}
+
+func newCompressor(w *ConWriter, level int, workers int) *compressor {
+	if _, err := flate.NewWriter(nil, level); err != nil {
+		level = flate.DefaultCompression
+	}
+	c := &compressor{
+		w:     w,
+		codec: &codec{alg: algDeflate, blockSz: defaultBlockSz},
+		level: level,
+		jobs:  make(chan *cjob, workers),
+		order: make(chan *cjob, 2*workers),
+		done:  make(chan struct{}),
+	}
+	c.pool.New = func() interface{} {
+		b := make([]byte, 0, c.codec.blockSz)
+		return &b
+	}
+	c.buf = c.pool.Get().(*[]byte)
+	c.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go c.work()
+	}
+	go c.emit()
+	return c
+}
+
+// work compresses the blocks.
+func (c *compressor) work() {
+	defer c.workers.Done()
+	fw, _ := flate.NewWriter(nil, c.level)
+	for job := range c.jobs {
+		fw.Reset(&job.out)
+		if _, err := fw.Write(*job.in); err != nil {
+			job.err = err
+		} else {
+			job.err = fw.Close()
+		}
+		close(job.ready)
+	}
+}
+
+// emit writes the compressed blocks in order.  After the first error, the
+// remaining blocks are discarded.
+func (c *compressor) emit() {
+	defer close(c.done)
+	for job := range c.order {
+		<-job.ready
+		if job.flush != nil {
+			close(job.flush)
+			continue
+		}
+		var perr error
+		if job.err == nil {
+			perr = c.w.pace(job.out.Len())
+		}
+		c.w.mu.Lock()
+		if c.w.err == nil {
+			if job.err != nil {
+				c.w.err = fmt.Errorf("error compressing frame: %w", job.err)
+			} else if perr != nil {
+				c.w.err = perr
+			} else if _, err := c.w.writeFrame(must(newBinHeader(job.out.Len(), false)), job.out.Bytes()); err != nil {
+				c.w.err = fmt.Errorf("deferred write error: %w", err)
+			} else {
+				c.w.account(*job.in)
+			}
+		}
+		c.w.mu.Unlock()
+		c.pool.Put(job.in)
+	}
+}
+
+// submit hands the current block over to workers.  Caller must hold c.mu.
+func (c *compressor) submit() {
+	job := &cjob{in: c.buf, ready: make(chan struct{})}
+	c.order <- job
+	c.jobs <- job
+	c.buf = c.pool.Get().(*[]byte)
+	*c.buf = (*c.buf)[:0]
+}
+
+// write appends p to the current block, submitting the full blocks.
+func (c *compressor) write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.w.check(); err != nil {
+		return 0, err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		k := c.codec.blockSz - len(*c.buf)
+		if k > len(p) {
+			k = len(p)
+		}
+		*c.buf = append(*c.buf, p[:k]...)
+		p = p[k:]
+		if len(*c.buf) == c.codec.blockSz {
+			c.submit()
+		}
+	}
+	return n, nil
+}
+
+// flush submits the incomplete block, and waits for all blocks to be written.
+func (c *compressor) flush() error {
+	c.mu.Lock()
+	if err := c.w.check(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if len(*c.buf) > 0 {
+		c.submit()
+	}
+	marker := &cjob{ready: make(chan struct{}), flush: make(chan struct{})}
+	close(marker.ready)
+	c.order <- marker
+	c.mu.Unlock()
+
+	<-marker.flush
+	c.w.mu.Lock()
+	defer c.w.mu.Unlock()
+	return c.w.err
+}
+
+// close submits the incomplete block, and stops the workers once all blocks
+// are written.
+func (c *compressor) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(*c.buf) > 0 {
+		c.submit()
+	}
+	close(c.jobs)
+	c.workers.Wait()
+	close(c.order)
+	<-c.done
+}
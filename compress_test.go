@@ -0,0 +1,238 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// testText returns sz bytes of compressible pseudo-random text.
+func testText(sz int) []byte {
+	words := []string{"controlled ", "reader ", "writer ", "frame ", "header ", "stream ", "closed ", "net.Conn ", "\n"}
+	rnd := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	for buf.Len() < sz {
+		buf.WriteString(words[rnd.Intn(len(words))])
+		if rnd.Intn(10) == 0 {
+			fmt.Fprint(&buf, rnd.Int63())
+		}
+	}
+	return buf.Bytes()[:sz]
+}
+
+func Test_loadCodec(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       []byte
+		want    *codec
+		wantErr bool
+	}{
+		{"ok", []byte{algDeflate, 0, 0, 0x10, 0}, &codec{alg: algDeflate, blockSz: 1 << 20}, false},
+		{"short", []byte{algDeflate, 0, 0, 0x10}, nil, true},
+		{"unknown algorithm", []byte{0xff, 0, 0, 0x10, 0}, nil, true},
+		{"zero block", []byte{algDeflate, 0, 0, 0, 0}, nil, true},
+		{"block overflow", []byte{algDeflate, 0, 0, 0, 0x80}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadCodec(tt.p)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadCodec() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadCodec() = %v, want %v", got, tt.want)
+			}
+			if got != nil {
+				if b := got.Bytes(); !bytes.Equal(b[hdrSz+1:], tt.p) {
+					t.Errorf("codec.Bytes() = % x, want % x", b[hdrSz+1:], tt.p)
+				}
+			}
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	data := testText(3*defaultBlockSz + 12345)
+	tests := []struct {
+		name    string
+		workers int
+		chunk   int // size of each Write
+	}{
+		{"one worker", 1, 64 << 10},
+		{"four workers", 4, 64 << 10},
+		{"small writes", 4, 100},
+		{"single write", 3, len(data)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, WithCompression(flate.BestSpeed), WithConcurrency(tt.workers))
+			for p := data; len(p) > 0; {
+				n := tt.chunk
+				if n > len(p) {
+					n = len(p)
+				}
+				if _, err := w.Write(p[:n]); err != nil {
+					t.Fatalf("ConWriter.Write() error = %v", err)
+				}
+				p = p[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("ConWriter.Close() error = %v", err)
+			}
+			if buf.Len() >= len(data) {
+				t.Errorf("stream is not compressed: %d bytes, data %d bytes", buf.Len(), len(data))
+			}
+
+			r := NewReader(&buf, WithConcurrency(tt.workers))
+			defer r.Close()
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ConReader.Read() error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("ConReader.Read() returned %d bytes, different from the %d bytes written", len(got), len(data))
+			}
+			if buf.Len() != 0 {
+				t.Errorf("ConReader consumed the stream partially, %d bytes left", buf.Len())
+			}
+		})
+	}
+}
+
+func TestCompression_flush(t *testing.T) {
+	var buf syncBuffer
+	w := NewWriter(&buf, WithCompression(flate.DefaultCompression))
+	if _, err := w.Write([]byte("hello, ")); err != nil {
+		t.Fatalf("ConWriter.Write() error = %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("ConWriter.Flush() error = %v", err)
+	}
+	if len(buf.Bytes()) == 0 {
+		t.Fatal("nothing is written on Flush")
+	}
+	if _, err := w.Write([]byte("world")); err != nil {
+		t.Fatalf("ConWriter.Write() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ConWriter.Close() error = %v", err)
+	}
+	got, err := ioutil.ReadAll(NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatalf("ConReader.Read() error = %v", err)
+	}
+	if want := "hello, world"; string(got) != want {
+		t.Errorf("ConReader.Read() = %q, want %q", got, want)
+	}
+}
+
+func TestCompression_transfer(t *testing.T) {
+	data := testText(defaultBlockSz + 1)
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		r := NewTransferReader(client)
+		defer r.Close()
+		io.Copy(ioutil.Discard, r)
+	}()
+	w := NewTransferWriter(server, 0, WithCompression(flate.BestSpeed))
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("ConWriter.Write() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("ConWriter.Close() error = %v", err)
+	}
+}
+
+func TestConReader_compressionErrors(t *testing.T) {
+	var compressed bytes.Buffer
+	fw, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+	fw.Write(bytes.Repeat([]byte{'a'}, 1000))
+	fw.Close()
+
+	frame := func(p []byte) []byte {
+		return append(must(newBinHeader(len(p), false)).Bytes(), p...)
+	}
+	stream := func(c *codec, frames ...[]byte) io.Reader {
+		buf := c.Bytes()
+		for _, f := range frames {
+			buf = append(buf, f...)
+		}
+		return bytes.NewReader(buf)
+	}
+	tests := []struct {
+		name    string
+		r       io.Reader
+		wantErr error
+	}{
+		{"block too big", stream(&codec{alg: algDeflate, blockSz: 999}, frame(compressed.Bytes())), errBlockSize},
+		{"corrupt", stream(&codec{alg: algDeflate, blockSz: 1000}, frame([]byte{0xff, 0xff, 0xff})), nil},
+		{"truncated", stream(&codec{alg: algDeflate, blockSz: 1000}, frame(compressed.Bytes())[:10]), io.ErrUnexpectedEOF},
+		{"unknown control", bytes.NewReader(ctlFrame(0xff, nil)), errUnknownControl},
+		{"duplicate codec", stream(&codec{alg: algDeflate, blockSz: 1000}, (&codec{alg: algDeflate, blockSz: 1000}).Bytes()), errInvalidControl},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(tt.r)
+			defer r.Close()
+			_, err := ioutil.ReadAll(r)
+			if err == nil {
+				t.Fatal("ConReader.Read() error = nil, want error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ConReader.Read() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func BenchmarkConWriter_compress(b *testing.B) {
+	data := testText(16 << 20)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				w := NewWriter(ioutil.Discard, WithCompression(flate.DefaultCompression), WithConcurrency(workers))
+				if _, err := w.Write(data); err != nil {
+					b.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkConReader_decompress(b *testing.B) {
+	data := testText(16 << 20)
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithCompression(flate.DefaultCompression))
+	w.Write(data)
+	w.Close()
+	stream := buf.Bytes()
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				r := NewReader(bytes.NewReader(stream), WithConcurrency(workers))
+				if _, err := io.Copy(ioutil.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+				r.Close()
+			}
+		})
+	}
+}
@@ -1,77 +1,740 @@
 // Package conio provides controlled I/O reader and writer.  It may be useful
 // when you need to have a compressed reader/writer over the net.Conn and then
 // resume your normal reads and writes on it.
+//
+// # Stream format
+//
+// The stream is a sequence of frames.  Each frame starts with the 4-byte
+// little-endian header.  The highest bit of the header is the closed flag,
+// and the lower 31 bits are the size of the payload that follows it.
+//
+// A header with the closed flag unset and a non-zero size is a data frame.
+//
+// A header with the closed flag unset and zero size is a heartbeat.  It
+// carries no data, and is skipped by the reader.
+//
+// A header with the closed flag set and zero size ends the stream.
+//
+// A header with the closed flag set and a non-zero size is a control frame.
+// The first byte of its payload identifies the kind of the control frame.
+//
+// # Sharing the connection with decoders
+//
+// ConReader reads exactly the stream, and never past its closed header.  It
+// is safe to share the connection with other readers, as long as they do not
+// read ahead.  Decoders that read ahead, like json.Decoder, may buffer the
+// beginning of the stream.  Use Rejoin, or RejoinJSON for json.Decoder, to
+// continue from the buffered data:
+//
+//	dec := json.NewDecoder(conn)
+//	if err := dec.Decode(&info); err != nil {
+//		return err
+//	}
+//	rest := conio.RejoinJSON(dec, conn)
+//	if _, err := io.Copy(w, conio.NewReader(rest)); err != nil {
+//		return err
+//	}
+//	dec = json.NewDecoder(rest)
+//
+// Decoders that only read ahead if the reader is not buffered, like
+// gob.Decoder, can share a single bufio.Reader with ConReader:
+//
+//	br := bufio.NewReader(conn)
+//	dec := gob.NewDecoder(br)
+//	// ...
+//	cr := conio.NewReader(br)
 package conio
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
+	"sync"
+	"time"
 )
 
-// ConReader is the controlled reader.
+var (
+	// ErrClosed is returned on attempt to write to, or to close the closed
+	// ConWriter.
+	ErrClosed = errors.New("writer is closed")
+	// errReaderClosed is returned on attempt to read from the closed
+	// ConReader.
+	errReaderClosed = errors.New("reader is closed")
+)
+
+// ConReader is the controlled reader.  If the stream is compressed, or if
+// prefetching is enabled (see WithPrefetch), the frames are read ahead in
+// background, and the reader must be closed if it is abandoned before the end
+// of the stream.
 type ConReader struct {
 	r      io.Reader
 	unread int
+	eof    bool // closed header has been received
+
+	hdr  [hdrSz]byte // partially read frame header
+	nhdr int         // bytes in hdr
+	ctl  *binheader  // control frame, whose payload is partially read
+	part []byte      // partially read control frame payload
+
+	workers  int        // number of decompression workers
+	prefetch int        // number of frames to read ahead
+	limit    int        // read-ahead memory limit
+	codec    *codec     // compression of the data frames, if any
+	ra       *readAhead // if set, the frames are read in background
+	cur      *rjob      // current read-ahead frame
+	pending  []byte     // unread data of the current read-ahead frame
+	err      error      // sticky read-ahead error
+
+	ack     io.Writer   // if set, the acknowledgement is sent here
+	n       int64       // bytes received
+	crc     hash.Hash32 // digest of the received bytes, if verified
+	summed  bool        // checksum trailer is expected
+	trailer *ack        // trailer, once received
+
+	frameSum uint32 // CRC-32 of the payload of the last data frame, as received
+	frameOff int64  // offset of the last data frame header
+	summable bool   // the frame sum of the last data frame can be verified
+
+	frame    int            // data size of the current frame
+	progress func(Progress) // progress callback
+	hint     int64          // expected size + 1, or 0 if unknown; atomic
+	stats    statsCollector
+	metrics  Metrics // metrics hook, if set
+	opened   bool    // the stream has been reported as opened
+	trace    *tracer // frame logger, if set
+
+	wire   int64      // offset of the next frame header in the stream
+	seeker io.Seeker  // underlying reader, if it is seekable
+	base   int64      // position of the stream start in the seeker
+	frames []frameLoc // data frames seen so far, once Seek is called
+	ended  bool       // the closed header has been seen, if seekable
+	seeked bool       // Seek has been called
+
+	multi  bool       // read the concatenated streams as one, see Multistream
+	peeked *binheader // header read by Next
+	closer io.Closer  // closed by Close, if set
+
+	rate *limiter        // rate limiter, if set
+	ctx  context.Context // rate limiter context
 }
 
-// ConReader is the controlled writer.  It must be closed after using.
+// ConWriter is the controlled writer.  It must be closed after using.
+//
+// ConWriter is safe for concurrent use by multiple goroutines.  Each Write is
+// atomic with respect to framing:  the data passed to a single Write call is
+// written as one frame, and frames written by different goroutines never
+// interleave.  The compressing writer (see WithCompression) packs data into
+// blocks instead, but the data of a single Write is still contiguous.
 type ConWriter struct {
 	w io.Writer
+
+	mu     sync.Mutex // guards writes to w and the fields below
+	pre    [][]byte   // control frames to write before the first frame
+	last   time.Time  // time of the last write
+	err    error      // sticky background (heartbeat or deferred write) error
+	closed bool       // Close has been called
+
+	async *asyncWriter // if set, frames are written in background
+	comp  *compressor  // if set, frames are compressed in background
+
+	stop chan struct{}  // closed to stop the heartbeat goroutine
+	wg   sync.WaitGroup // heartbeat goroutine
+
+	ack      io.Reader     // if set, the acknowledgement is expected from here
+	timeout  time.Duration // acknowledgement timeout
+	deadline time.Time     // read deadline of ack, see WithReadDeadline
+	n        int64         // bytes sent
+	crc      hash.Hash32   // digest of the sent bytes, if verified
+
+	progress  func(Progress) // progress callback
+	hinted    bool           // size hint is declared
+	summed    bool           // checksum trailer is sent
+	frameSums bool           // each data frame is followed by its checksum
+	hint      int64          // declared size of the stream data
+	reserved  int64          // bytes accepted by Write; atomic
+	stats     statsCollector
+	metrics   Metrics   // metrics hook, if set
+	opened    sync.Once // reports the stream as opened
+	trace     *tracer   // frame logger, if set
+	onFrame   func(int) // called before each data frame is written, if set
+	closer    io.Closer // closed by Close, if set
+
+	rate *limiter        // rate limiter, if set
+	ctx  context.Context // rate limiter context
 }
 
 // NewReader creates a new ConReader.
-func NewReader(r io.Reader) *ConReader {
-	return &ConReader{r: r}
+func NewReader(r io.Reader, opts ...Option) *ConReader {
+	cr := &ConReader{r: r}
+	cr.init(newOptions(opts))
+	return cr
+}
+
+// init applies options to the reader.
+func (r *ConReader) init(o options) {
+	r.workers = o.workers()
+	r.prefetch = o.prefetch
+	r.limit = o.prefetchLimit
+	r.progress = o.progress
+	r.metrics = o.metrics
+	r.trace = newTracer(o.logger, DirRead)
+	r.rate, r.ctx = o.limiter(), o.context()
+	r.initSeek()
 }
 
 // NewWriter creates a new ConWriter.
-func NewWriter(w io.Writer) *ConWriter {
-	return &ConWriter{w}
+func NewWriter(w io.Writer, opts ...Option) *ConWriter {
+	cw := &ConWriter{w: w}
+	cw.init(newOptions(opts))
+	return cw
 }
 
-// Read reads the data from the underlying reader into p.
+// init applies options to the writer and starts the background goroutines.
+func (w *ConWriter) init(o options) {
+	w.progress = o.progress
+	w.metrics = o.metrics
+	w.trace = newTracer(o.logger, DirWrite)
+	w.rate, w.ctx = o.limiter(), o.context()
+	if o.compress {
+		w.comp = newCompressor(w, o.level, o.workers())
+		w.pre = append(w.pre, w.comp.codec.Bytes())
+	} else if o.async > 0 {
+		w.async = newAsyncWriter(w, o.async)
+	}
+	if o.hinted {
+		w.hinted, w.hint = true, o.sizeHint
+		w.pre = append(w.pre, sizeHintFrame(o.sizeHint))
+	}
+	if o.checksum {
+		w.summed = true
+		if w.crc == nil {
+			w.crc = crc32.NewIEEE()
+		}
+		w.pre = append(w.pre, checksumFrame())
+	}
+	w.frameSums = o.frameSums
+	if o.keepalive > 0 {
+		w.last = time.Now()
+		w.stop = make(chan struct{})
+		w.wg.Add(1)
+		go w.keepalive(o.keepalive)
+	}
+}
+
+// keepalive sends a heartbeat each time the writer stays idle for the
+// duration of interval, until the stop channel is closed.
+func (w *ConWriter) keepalive(interval time.Duration) {
+	defer w.wg.Done()
+	t := time.NewTimer(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-t.C:
+		}
+		w.mu.Lock()
+		next := interval - time.Since(w.last)
+		if next <= 0 {
+			if _, err := must(newBinHeader(0, false)).WriteTo(w.w); err != nil {
+				w.err = fmt.Errorf("error sending heartbeat: %w", err)
+				w.mu.Unlock()
+				return
+			}
+			w.stats.heartbeat()
+			if w.trace != nil {
+				w.trace.frame(0, false, 0)
+			}
+			w.last = time.Now()
+			next = interval
+		}
+		w.mu.Unlock()
+		t.Reset(next)
+	}
+}
+
+// Read reads the data from the underlying reader into p.  It returns io.EOF
+// once the closed header is received, and io.ErrUnexpectedEOF if the
+// underlying reader ends in the middle of the frame or before the closed
+// header.
 func (r *ConReader) Read(p []byte) (int, error) {
+	if r.metrics == nil && r.trace == nil {
+		return r.read(p)
+	}
+	if r.metrics != nil && !r.opened {
+		r.opened = true
+		r.metrics.StreamOpened(DirRead)
+	}
+	n, err := r.read(p)
+	if err != nil && err != io.EOF {
+		if r.metrics != nil {
+			r.metrics.Error(DirRead, err)
+		}
+		if r.trace != nil {
+			r.trace.error(err)
+		}
+	}
+	return n, err
+}
+
+func (r *ConReader) read(p []byte) (int, error) {
+	for {
+		n, err := r.readStream(p)
+		if err != io.EOF || !r.multi {
+			return n, err
+		}
+		if err := r.Next(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readStream reads the data of the current stream into p.
+func (r *ConReader) readStream(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
+	if r.eof {
+		return 0, io.EOF
+	}
 
-	if r.unread == 0 {
-		hdr, err := readHeader(r.r)
-		if err != nil {
+	if r.ra == nil && r.unread == 0 && r.prefetch > 0 {
+		r.ra = newReadAhead(r, r.workers, r.prefetch, r.limit)
+	}
+	for r.ra == nil && r.unread == 0 {
+		size, err := r.nextFrame()
+		if err == io.EOF {
+			return 0, r.finish()
+		} else if err != nil {
 			return 0, err
 		}
-		r.unread = hdr.Size()
-		if hdr.IsClosed() {
-			return 0, io.EOF
+		if r.codec == nil {
+			if err := r.checkSize(size); err != nil {
+				return 0, err
+			}
 		}
+		r.unread = size
+		r.frame = size
+		if err := r.pace(size); err != nil {
+			return 0, err
+		}
+		if r.codec != nil {
+			r.ra = newReadAhead(r, r.workers, 0, r.limit)
+		}
+	}
+	if r.ra != nil {
+		return r.readAhead(p)
 	}
 	if r.unread < len(p) {
 		p = p[:r.unread]
 	}
 	n, err := r.r.Read(p)
 	r.unread -= n
+	r.frameSum = crc32.Update(r.frameSum, crc32.IEEETable, p[:n])
+	r.account(p[:n])
+	if err == io.EOF {
+		if r.unread > 0 {
+			// the stream is cut in the middle of the frame.
+			err = io.ErrUnexpectedEOF
+		} else {
+			// the frame is complete, the next header read reports the
+			// stream that ends without the closed header.
+			err = nil
+		}
+	}
 	return n, err
 }
 
-// Writes writes the data to the underlying reader.
+// nextFrame reads the next frame header from the underlying reader, skipping
+// heartbeats, and returns the size of the data frame.  If it encounters the
+// control frame, it processes it and returns zero size.  It returns io.EOF
+// if the stream is closed, and io.ErrUnexpectedEOF if the underlying reader
+// ends before the closed header.
+func (r *ConReader) nextFrame() (int, error) {
+	if hdr := r.ctl; hdr != nil {
+		// the payload read has been interrupted by the error.
+		return 0, r.controlFrame(hdr)
+	}
+	for {
+		hdr, err := r.header()
+		if err == io.EOF {
+			// the stream ends without the closed header.
+			return 0, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return 0, err
+		}
+		off := r.wire
+		r.wire += hdrSz + int64(hdr.Size())
+		if r.trace != nil && !(hdr.IsClosed() && hdr.Size() > 0) {
+			r.trace.frame(hdr.Size(), hdr.IsClosed(), 0)
+		}
+		switch {
+		case hdr.IsClosed() && hdr.Size() == 0:
+			r.stats.closed()
+			if r.metrics != nil {
+				r.metrics.StreamClosed(DirRead)
+			}
+			if r.seeker != nil {
+				r.ended = true
+			}
+			return 0, io.EOF
+		case hdr.IsClosed():
+			return 0, r.controlFrame(hdr)
+		case hdr.Size() > 0:
+			r.stats.data(hdr.Size())
+			if r.metrics != nil {
+				r.metrics.Frame(DirRead, hdr.Size())
+			}
+			if r.seeked {
+				r.record(off, hdr.Size())
+			}
+			r.frameSum, r.frameOff, r.summable = 0, off, true
+			return hdr.Size(), nil
+		}
+		r.stats.heartbeat()
+	}
+}
+
+// controlFrame reads and processes the payload of the control frame with
+// the header hdr.  If the read fails, the payload read so far is kept, and
+// the next call to nextFrame resumes it, so that the read interrupted by the
+// deadline can be retried.
+func (r *ConReader) controlFrame(hdr *binheader) error {
+	if hdr.Size() > maxCtlSz {
+		return fmt.Errorf("%w: size %d", errInvalidControl, hdr.Size())
+	}
+	if r.part == nil {
+		r.part = make([]byte, 0, hdr.Size())
+	}
+	r.ctl = hdr
+	n, err := io.ReadFull(r.r, r.part[len(r.part):hdr.Size()])
+	r.part = r.part[:len(r.part)+n]
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	p := r.part
+	r.ctl, r.part = nil, nil
+	if r.trace != nil {
+		r.trace.frame(hdr.Size(), true, p[0])
+	}
+	r.stats.control(hdr.Size())
+	return r.control(p)
+}
+
+// pace waits for the rate limiter to allow receiving the frame with the
+// payload of size bytes.
+func (r *ConReader) pace(size int) error {
+	if r.rate == nil {
+		return nil
+	}
+	return r.rate.wait(r.ctx, hdrSz+size)
+}
+
+// finish marks the end of the stream, and sends the acknowledgement if
+// required.  It returns io.EOF, or the acknowledgement error.
+func (r *ConReader) finish() error {
+	r.eof = true
+	if r.seeked {
+		// the data has not been read in order, so it can not be verified.
+		return io.EOF
+	}
+	if r.ack != nil {
+		if err := r.sendAck(); err != nil {
+			return err
+		}
+	}
+	if err := r.checkTrailer(); err != nil {
+		return err
+	}
+	if err := r.checkShort(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// account updates the received data counters, and reports the progress.
+func (r *ConReader) account(p []byte) {
+	r.n += int64(len(p))
+	if r.crc != nil {
+		r.crc.Write(p)
+	}
+	if r.progress != nil && len(p) > 0 {
+		total := r.ExpectedSize()
+		if total < 0 {
+			total = 0
+		}
+		r.progress(Progress{Frame: r.frame, Bytes: r.n, Total: total})
+	}
+}
+
+// Close stops the background goroutines of the reader, if any.  It does
+// not close the underlying reader, unless the reader was created by Pipe.
+func (r *ConReader) Close() error {
+	if r.ra != nil {
+		r.ra.close()
+	}
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// Write writes the data to the underlying writer as a single frame.  If the
+// writer is asynchronous (see WithAsync), or compressing (see
+// WithCompression), Write returns as soon as p is copied, and the write
+// error, if any, is returned by one of the subsequent calls to Write, Flush
+// or Close.
 func (w *ConWriter) Write(p []byte) (int, error) {
+	if w.metrics == nil && w.trace == nil {
+		return w.write(p)
+	}
+	if w.metrics != nil {
+		w.opened.Do(func() { w.metrics.StreamOpened(DirWrite) })
+	}
+	n, err := w.write(p)
+	if err != nil {
+		w.failed(err)
+	}
+	return n, err
+}
+
+func (w *ConWriter) write(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
+	if w.comp != nil {
+		if err := w.reserve(len(p)); err != nil {
+			return 0, err
+		}
+		return w.comp.write(p)
+	}
 	hdr, err := newBinHeader(len(p), false)
 	if err != nil {
 		return 0, err
 	}
+	if err := w.reserve(len(p)); err != nil {
+		return 0, err
+	}
+	if w.async != nil {
+		return w.async.write(p)
+	}
+	if err := w.pace(len(p)); err != nil {
+		return 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.checkLocked(); err != nil {
+		return 0, err
+	}
+	n, err := w.writeFrame(hdr, p)
+	w.account(p[:n])
+	return n, err
+}
+
+// writeFrame writes the frame header and payload p to the underlying writer.
+// Caller must hold w.mu.
+func (w *ConWriter) writeFrame(hdr *binheader, p []byte) (int, error) {
+	if err := w.writePreamble(); err != nil {
+		return 0, err
+	}
+	if w.onFrame != nil {
+		w.onFrame(len(p))
+	}
+	w.last = time.Now()
 	if _, err := hdr.WriteTo(w.w); err != nil {
 		return 0, err
 	}
-	return w.w.Write(p)
+	w.stats.data(len(p))
+	if w.metrics != nil {
+		w.metrics.Frame(DirWrite, len(p))
+	}
+	if w.trace != nil {
+		w.trace.frame(len(p), false, 0)
+	}
+	n, err := w.w.Write(p)
+	if err != nil || !w.frameSums {
+		return n, err
+	}
+	return n, w.writeControl(frameSumFrame(p))
 }
 
-// Close closes the Writer.
+// pace waits for the rate limiter to allow sending the frame with the
+// payload of size bytes.  Caller must not hold w.mu.
+func (w *ConWriter) pace(size int) error {
+	if w.rate == nil {
+		return nil
+	}
+	return w.rate.wait(w.ctx, hdrSz+size)
+}
+
+// writePreamble writes the pending control frames.  Caller must hold w.mu.
+func (w *ConWriter) writePreamble() error {
+	for len(w.pre) > 0 {
+		if err := w.writeControl(w.pre[0]); err != nil {
+			return err
+		}
+		w.pre = w.pre[1:]
+	}
+	return nil
+}
+
+// writeControl writes the serialised control frame p.  Caller must hold
+// w.mu.
+func (w *ConWriter) writeControl(p []byte) error {
+	if _, err := w.w.Write(p); err != nil {
+		return err
+	}
+	w.stats.control(len(p) - hdrSz)
+	if w.trace != nil {
+		w.trace.frame(len(p)-hdrSz, true, p[hdrSz])
+	}
+	return nil
+}
+
+// account updates the sent data counters, and reports the progress.
+// Caller must hold w.mu.
+func (w *ConWriter) account(p []byte) {
+	w.n += int64(len(p))
+	if w.crc != nil {
+		w.crc.Write(p)
+	}
+	if w.progress != nil && len(p) > 0 {
+		w.progress(Progress{Frame: len(p), Bytes: w.n, Total: w.hint})
+	}
+}
+
+// check returns an error if the writer is closed or failed.
+func (w *ConWriter) check() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.checkLocked()
+}
+
+// checkLocked is check for callers holding w.mu.
+func (w *ConWriter) checkLocked() error {
+	if w.closed {
+		return ErrClosed
+	}
+	return w.err
+}
+
+// Flush waits until all data written to an asynchronous or compressing
+// writer is written to the underlying writer, and returns the deferred write
+// error, if any.  For a synchronous writer it is a no-op.
+func (w *ConWriter) Flush() error {
+	switch {
+	case w.comp != nil:
+		return w.comp.flush()
+	case w.async != nil:
+		return w.async.flush()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close closes the Writer.  If the writer was created with
+// NewTransferWriter, Close waits for the acknowledgement for the duration of
+// the timeout.
 func (w *ConWriter) Close() error {
+	ctx := context.Background()
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+	return w.CloseContext(ctx)
+}
+
+// CloseContext closes the Writer.  If the writer was created with
+// NewTransferWriter, CloseContext waits for the acknowledgement until ctx is
+// done, see NewTransferWriter.  The concurrent calls to Write return
+// ErrClosed while CloseContext waits.
+func (w *ConWriter) CloseContext(ctx context.Context) error {
+	if w.metrics == nil && w.trace == nil {
+		return w.close(ctx)
+	}
+	if w.metrics != nil {
+		w.opened.Do(func() { w.metrics.StreamOpened(DirWrite) })
+	}
+	err := w.close(ctx)
+	if err != nil {
+		w.failed(err)
+	}
+	return err
+}
+
+// failed reports the error returned by Write or Close to the metrics hook
+// and the frame logger.
+func (w *ConWriter) failed(err error) {
+	if w.metrics != nil {
+		w.metrics.Error(DirWrite, err)
+	}
+	if w.trace != nil {
+		w.trace.error(err)
+	}
+}
+
+func (w *ConWriter) close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	w.mu.Unlock()
+	if w.closer != nil {
+		defer w.closer.Close()
+	}
+
+	switch {
+	case w.comp != nil:
+		w.comp.close()
+	case w.async != nil:
+		w.async.close()
+	}
+	if w.stop != nil {
+		close(w.stop)
+		w.wg.Wait()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if w.summed {
+		w.pre = append(w.pre, trailerFrame(ack{n: w.n, sum: w.crc.Sum32()}))
+	}
+	if err := w.writePreamble(); err != nil {
+		return fmt.Errorf("error closing writer: %w", err)
+	}
 	if _, err := must(newBinHeader(0, true)).WriteTo(w.w); err != nil {
 		return fmt.Errorf("error closing writer: %w", err)
 	}
-	return nil
+	w.stats.closed()
+	if w.metrics != nil {
+		w.metrics.StreamClosed(DirWrite)
+	}
+	if w.trace != nil {
+		w.trace.frame(0, true, 0)
+	}
+	if w.ack != nil {
+		// the writer is closed, and the fields used by waitAck no longer
+		// change, so the lock is released for the concurrent calls to return
+		// ErrClosed instead of waiting for the acknowledgement.
+		w.mu.Unlock()
+		err := w.waitAck(ctx)
+		w.mu.Lock()
+		if err != nil {
+			return err
+		}
+	}
+	return w.checkShort()
 }
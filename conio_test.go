@@ -5,8 +5,14 @@ package conio
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"io/ioutil"
+	"reflect"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestConWriter_Write(t *testing.T) {
@@ -119,6 +125,24 @@ func TestConReader_Read(t *testing.T) {
 			[]byte{19, 91, 9, 16},
 			false,
 		},
+		{"heartbeats skipped",
+			fields{
+				r: bytes.NewReader([]byte{0, 0, 0, 0, 0, 0, 0, 0, 04, 00, 00, 00, 19, 91, 9, 16}),
+			},
+			args{make([]byte, 100)},
+			4,
+			[]byte{19, 91, 9, 16},
+			false,
+		},
+		{"heartbeat then closed",
+			fields{
+				r: bytes.NewReader([]byte{0, 0, 0, 0, 0, 0, 0, 0x80}),
+			},
+			args{make([]byte, 100)},
+			0,
+			[]byte{},
+			true,
+		},
 		{"four bytes unread",
 			fields{
 				r:      bytes.NewReader([]byte{19, 91, 9, 16}), // this should result in EOF
@@ -150,3 +174,235 @@ func TestConReader_Read(t *testing.T) {
 		})
 	}
 }
+
+func TestConWriter_keepalive(t *testing.T) {
+	var buf syncBuffer
+	w := NewWriter(&buf, WithKeepalive(5*time.Millisecond))
+	if _, err := w.Write([]byte{19, 91}); err != nil {
+		t.Fatalf("ConWriter.Write() error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := w.Write([]byte{9, 16}); err != nil {
+		t.Fatalf("ConWriter.Write() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ConWriter.Close() error = %v", err)
+	}
+
+	stream := buf.Bytes()
+	heartbeat := []byte{0, 0, 0, 0}
+	if !bytes.Contains(stream[6:len(stream)-10], heartbeat) {
+		t.Errorf("no heartbeats in the stream: % x", stream)
+	}
+	got, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream)))
+	if err != nil {
+		t.Fatalf("ConReader.Read() error = %v", err)
+	}
+	if want := []byte{19, 91, 9, 16}; !bytes.Equal(got, want) {
+		t.Errorf("ConReader.Read() = % x, want % x", got, want)
+	}
+}
+
+// syncBuffer is the bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Bytes()
+}
+
+func TestConWriter_concurrent(t *testing.T) {
+	const (
+		writers = 32
+		writes  = 200
+	)
+	var buf syncBuffer
+	w := NewWriter(&buf, WithKeepalive(time.Millisecond))
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(id byte) {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				// payload of varying size, every byte is the writer id.
+				p := bytes.Repeat([]byte{id}, 1+(j*int(id))%512)
+				if _, err := w.Write(p); err != nil {
+					t.Errorf("ConWriter.Write() error = %v", err)
+					return
+				}
+			}
+		}(byte(i + 1))
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatalf("ConWriter.Close() error = %v", err)
+	}
+
+	// every frame must be intact, and contain the data of a single writer.
+	var counts [writers + 1]int
+	r := bytes.NewReader(buf.Bytes())
+	for {
+		hdr, err := readHeader(r)
+		if err != nil {
+			t.Fatalf("readHeader() error = %v", err)
+		}
+		if hdr.IsClosed() {
+			break
+		}
+		if hdr.Size() == 0 {
+			continue // heartbeat
+		}
+		p := make([]byte, hdr.Size())
+		if _, err := io.ReadFull(r, p); err != nil {
+			t.Fatalf("payload read error = %v", err)
+		}
+		id := p[0]
+		if id == 0 || id > writers {
+			t.Fatalf("invalid writer id: %d", id)
+		}
+		if want := 1 + (counts[id]*int(id))%512; len(p) != want {
+			t.Errorf("writer %d frame %d: size = %d, want %d", id, counts[id], len(p), want)
+		}
+		if !bytes.Equal(p, bytes.Repeat([]byte{id}, len(p))) {
+			t.Errorf("writer %d frame %d is corrupt: % x", id, counts[id], p)
+		}
+		counts[id]++
+	}
+	for id := 1; id <= writers; id++ {
+		if counts[id] != writes {
+			t.Errorf("writer %d: frames = %d, want %d", id, counts[id], writes)
+		}
+	}
+}
+
+func TestConWriter_closed(t *testing.T) {
+	w := NewWriter(ioutil.Discard, WithKeepalive(time.Millisecond))
+	if err := w.Close(); err != nil {
+		t.Fatalf("ConWriter.Close() error = %v", err)
+	}
+	if _, err := w.Write([]byte{1}); err != ErrClosed {
+		t.Errorf("ConWriter.Write() error = %v, want %v", err, ErrClosed)
+	}
+	if err := w.Close(); err != ErrClosed {
+		t.Errorf("ConWriter.Close() error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestWithProgress(t *testing.T) {
+	var (
+		buf     bytes.Buffer
+		written []Progress
+		read    []Progress
+	)
+	w := NewWriter(&buf, WithProgress(func(p Progress) { written = append(written, p) }))
+	for _, p := range [][]byte{{1, 2, 3}, {4}, {5, 6}} {
+		if _, err := w.Write(p); err != nil {
+			t.Fatalf("ConWriter.Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ConWriter.Close() error = %v", err)
+	}
+	wantWritten := []Progress{{Frame: 3, Bytes: 3}, {Frame: 1, Bytes: 4}, {Frame: 2, Bytes: 6}}
+	if !reflect.DeepEqual(written, wantWritten) {
+		t.Errorf("writer progress = %v, want %v", written, wantWritten)
+	}
+
+	r := NewReader(&buf, WithProgress(func(p Progress) { read = append(read, p) }))
+	p := make([]byte, 2)
+	for {
+		if _, err := r.Read(p); err != nil {
+			break
+		}
+	}
+	wantRead := []Progress{{Frame: 3, Bytes: 2}, {Frame: 3, Bytes: 3}, {Frame: 1, Bytes: 4}, {Frame: 2, Bytes: 6}}
+	if !reflect.DeepEqual(read, wantRead) {
+		t.Errorf("reader progress = %v, want %v", read, wantRead)
+	}
+}
+
+func TestConReader_truncated(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithSizeHint(8), WithChecksum())
+	if _, err := w.Write([]byte("01234567")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stream := buf.Bytes()
+	payload := bytes.Index(stream, []byte("01234567"))
+	control := hdrSz // the size hint payload
+	tests := []struct {
+		name  string
+		opts  []Option
+		cut   int
+		wantN int
+		src   func(io.Reader) io.Reader // wraps the truncated stream, if set
+	}{
+		{"after control header", nil, control, 0, nil},
+		{"in control", nil, control + 2, 0, nil},
+		{"in header", nil, payload - 2, 0, nil},
+		{"after header", nil, payload, 0, nil},
+		{"in payload", nil, payload + 3, 3, nil},
+		{"before trailer", nil, payload + 8, 8, nil},
+		{"before closed header", nil, len(stream) - hdrSz, 8, nil},
+		{"prefetch after control header", []Option{WithPrefetch(2, 0)}, control, 0, nil},
+		{"prefetch in header", []Option{WithPrefetch(2, 0)}, payload - 2, 0, nil},
+		{"prefetch after header", []Option{WithPrefetch(2, 0)}, payload, 0, nil},
+		{"prefetch in payload", []Option{WithPrefetch(2, 0)}, payload + 3, 0, nil},
+		{"prefetch before closed header", []Option{WithPrefetch(2, 0)}, len(stream) - hdrSz, 8, nil},
+		{"data err before trailer", nil, payload + 8, 8, iotest.DataErrReader},
+		{"prefetch data err before trailer", []Option{WithPrefetch(2, 0)}, payload + 8, 8, iotest.DataErrReader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var src io.Reader = bytes.NewReader(stream[:tt.cut])
+			if tt.src != nil {
+				src = tt.src(src)
+			}
+			r := NewReader(src, tt.opts...)
+			defer r.Close()
+			got, err := ioutil.ReadAll(r)
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("ConReader.Read() error = %v, want %v", err, io.ErrUnexpectedEOF)
+			}
+			if len(got) != tt.wantN {
+				t.Errorf("ConReader.Read() = %d bytes, want %d", len(got), tt.wantN)
+			}
+		})
+	}
+}
+
+// writeStream writes each of frames with a separate Write to w, and closes
+// it.  The writer is flushed after each Write, so that each one is written
+// as a separate frame, even if w compresses the data.  ErrShortStream
+// returned by Close is ignored, the tests write the short streams on
+// purpose.
+func writeStream(t testing.TB, w io.WriteCloser, frames ...string) {
+	t.Helper()
+	for _, p := range frames {
+		if _, err := io.WriteString(w, p); err != nil {
+			t.Fatal(err)
+		}
+		if f, ok := w.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil && !errors.Is(err, ErrShortStream) {
+		t.Fatal(err)
+	}
+}
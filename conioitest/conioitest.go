@@ -0,0 +1,320 @@
+// Package conioitest implements the readers and writers that inject faults
+// into the transport, and the conformance suite for the framed streams, to
+// test the code built on conio.  The readers and writers complement the ones
+// in testing/iotest.
+package conioitest
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrInjected is the default error returned by FailReader and FailWriter.
+var ErrInjected = errors.New("conioitest: injected failure")
+
+// FragmentReader returns the reader that reads at most n bytes from r on
+// each Read, simulating the fragmented network transfer.  n must be
+// positive.
+func FragmentReader(r io.Reader, n int) io.Reader {
+	if n <= 0 {
+		panic("conioitest: invalid fragment size")
+	}
+	return &fragmentReader{r: r, n: n}
+}
+
+type fragmentReader struct {
+	r io.Reader
+	n int
+}
+
+func (f *fragmentReader) Read(p []byte) (int, error) {
+	if len(p) > f.n {
+		p = p[:f.n]
+	}
+	return f.r.Read(p)
+}
+
+// FragmentWriter returns the writer that splits each Write into the writes of
+// at most n bytes to w.  n must be positive.
+func FragmentWriter(w io.Writer, n int) io.Writer {
+	if n <= 0 {
+		panic("conioitest: invalid fragment size")
+	}
+	return &fragmentWriter{w: w, n: n}
+}
+
+type fragmentWriter struct {
+	w io.Writer
+	n int
+}
+
+func (f *fragmentWriter) Write(p []byte) (int, error) {
+	var total int
+	for len(p) > 0 {
+		sz := len(p)
+		if sz > f.n {
+			sz = f.n
+		}
+		n, err := f.w.Write(p[:sz])
+		total += n
+		if err != nil {
+			return total, err
+		}
+		p = p[sz:]
+	}
+	return total, nil
+}
+
+// DelayReader returns the reader that sleeps for d before each Read from r.
+func DelayReader(r io.Reader, d time.Duration) io.Reader {
+	return &delayReader{r: r, d: d}
+}
+
+type delayReader struct {
+	r io.Reader
+	d time.Duration
+}
+
+func (dr *delayReader) Read(p []byte) (int, error) {
+	time.Sleep(dr.d)
+	return dr.r.Read(p)
+}
+
+// DelayWriter returns the writer that sleeps for d before each Write to w.
+func DelayWriter(w io.Writer, d time.Duration) io.Writer {
+	return &delayWriter{w: w, d: d}
+}
+
+type delayWriter struct {
+	w io.Writer
+	d time.Duration
+}
+
+func (dw *delayWriter) Write(p []byte) (int, error) {
+	time.Sleep(dw.d)
+	return dw.w.Write(p)
+}
+
+// corrupter flips the bits of the byte at the offset off of the stream.
+type corrupter struct {
+	off  int64 // offset of the byte to corrupt
+	mask byte  // bits to flip
+	pos  int64 // offset of the next byte
+}
+
+// apply corrupts p, if it contains the target byte, and advances the offset.
+// It returns p, or its corrupted copy.
+func (c *corrupter) apply(p []byte) []byte {
+	if i := c.off - c.pos; 0 <= i && i < int64(len(p)) {
+		q := append([]byte(nil), p...)
+		q[i] ^= c.mask
+		p = q
+	}
+	c.pos += int64(len(p))
+	return p
+}
+
+// CorruptReader returns the reader that flips the bits set in mask of the
+// byte at the offset off of the data read from r.
+func CorruptReader(r io.Reader, off int64, mask byte) io.Reader {
+	return &corruptReader{r: r, c: corrupter{off: off, mask: mask}}
+}
+
+type corruptReader struct {
+	r io.Reader
+	c corrupter
+}
+
+func (cr *corruptReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	copy(p, cr.c.apply(p[:n]))
+	return n, err
+}
+
+// CorruptWriter returns the writer that flips the bits set in mask of the
+// byte at the offset off of the data written to w.
+func CorruptWriter(w io.Writer, off int64, mask byte) io.Writer {
+	return &corruptWriter{w: w, c: corrupter{off: off, mask: mask}}
+}
+
+type corruptWriter struct {
+	w io.Writer
+	c corrupter
+}
+
+func (cw *corruptWriter) Write(p []byte) (int, error) {
+	return cw.w.Write(cw.c.apply(p))
+}
+
+// FailReader returns the reader that reads the first n bytes from r, and
+// then returns err.  If err is nil, ErrInjected is returned.
+func FailReader(r io.Reader, n int64, err error) io.Reader {
+	if err == nil {
+		err = ErrInjected
+	}
+	return &failReader{r: r, left: n, err: err}
+}
+
+type failReader struct {
+	r    io.Reader
+	left int64
+	err  error
+}
+
+func (f *failReader) Read(p []byte) (int, error) {
+	if f.left <= 0 {
+		return 0, f.err
+	}
+	if int64(len(p)) > f.left {
+		p = p[:f.left]
+	}
+	n, err := f.r.Read(p)
+	f.left -= int64(n)
+	return n, err
+}
+
+// FailWriter returns the writer that writes the first n bytes to w, and then
+// returns err.  If err is nil, ErrInjected is returned.
+func FailWriter(w io.Writer, n int64, err error) io.Writer {
+	if err == nil {
+		err = ErrInjected
+	}
+	return &failWriter{w: w, left: n, err: err}
+}
+
+type failWriter struct {
+	w    io.Writer
+	left int64
+	err  error
+}
+
+func (f *failWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= f.left {
+		n, err := f.w.Write(p)
+		f.left -= int64(n)
+		return n, err
+	}
+	n, err := f.w.Write(p[:f.left])
+	f.left -= int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, f.err
+}
+
+// hdrSz is the size of the frame header.
+const hdrSz = 4
+
+// closedBit is the closed flag of the frame header.
+const closedBit = 1 << 31
+
+// dropper removes the end of stream header, that is, the closed header with
+// zero size, and everything that follows it from the stream.
+type dropper struct {
+	hdr   [hdrSz]byte // incomplete header
+	nh    int         // bytes in hdr
+	left  int64       // payload bytes of the current frame left
+	ended bool        // end of stream header has been seen
+}
+
+// filter returns the data of p that precedes the end of stream header.  The
+// incomplete header at the end of p is held back until it is complete.
+func (d *dropper) filter(p []byte) []byte {
+	var out []byte
+	for len(p) > 0 && !d.ended {
+		if d.left > 0 {
+			n := int64(len(p))
+			if n > d.left {
+				n = d.left
+			}
+			out = append(out, p[:n]...)
+			d.left -= n
+			p = p[n:]
+			continue
+		}
+		n := copy(d.hdr[d.nh:], p)
+		d.nh += n
+		p = p[n:]
+		if d.nh < hdrSz {
+			break
+		}
+		d.nh = 0
+		h := binary.LittleEndian.Uint32(d.hdr[:])
+		if h == closedBit {
+			d.ended = true
+			break
+		}
+		out = append(out, d.hdr[:]...)
+		d.left = int64(h &^ closedBit)
+	}
+	return out
+}
+
+// flush returns the incomplete header held back.
+func (d *dropper) flush() []byte {
+	p := d.hdr[:d.nh]
+	d.nh = 0
+	return p
+}
+
+// DropClosedReader returns the reader that reads the conio stream from r,
+// and drops the end of stream header, and the data that follows it.  The
+// reader sees the stream as if the connection was broken just before the
+// stream was closed.
+func DropClosedReader(r io.Reader) io.Reader {
+	return &dropReader{r: r}
+}
+
+type dropReader struct {
+	r   io.Reader
+	d   dropper
+	out []byte // filtered data not returned yet
+	err error  // error of the underlying reader
+}
+
+func (dr *dropReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for len(dr.out) == 0 {
+		if dr.d.ended {
+			return 0, io.EOF
+		}
+		if dr.err != nil {
+			if tail := dr.d.flush(); len(tail) > 0 {
+				dr.out = tail
+				break
+			}
+			return 0, dr.err
+		}
+		var n int
+		n, dr.err = dr.r.Read(p)
+		dr.out = dr.d.filter(p[:n])
+	}
+	n := copy(p, dr.out)
+	dr.out = dr.out[n:]
+	return n, nil
+}
+
+// DropClosedWriter returns the writer that writes the conio stream to w,
+// and drops the end of stream header, and the data that follows it.  The
+// dropped data is reported as written.
+func DropClosedWriter(w io.Writer) io.Writer {
+	return &dropWriter{w: w}
+}
+
+type dropWriter struct {
+	w io.Writer
+	d dropper
+}
+
+func (dw *dropWriter) Write(p []byte) (int, error) {
+	if out := dw.d.filter(p); len(out) > 0 {
+		if _, err := dw.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
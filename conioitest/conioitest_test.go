@@ -0,0 +1,172 @@
+package conioitest
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/rusq/conio"
+)
+
+func TestConio(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []conio.Option
+	}{
+		{"plain", nil},
+		{"async", []conio.Option{conio.WithAsync(2)}},
+		{"compressed", []conio.Option{conio.WithCompression(flate.BestSpeed)}},
+		{"prefetch", []conio.Option{conio.WithPrefetch(4, 0)}},
+		{"checksum", []conio.Option{conio.WithChecksum(), conio.WithFrameChecksum()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			TestFramer(t, Conio(tt.opts...))
+		})
+	}
+}
+
+func TestFragmentReader(t *testing.T) {
+	r := FragmentReader(bytes.NewReader([]byte("abcdefg")), 3)
+	var got []int
+	p := make([]byte, 10)
+	for {
+		n, err := r.Read(p)
+		if err == io.EOF {
+			break
+		}
+		got = append(got, n)
+	}
+	if want := []int{3, 3, 1}; !equalInts(got, want) {
+		t.Errorf("read sizes = %v, want %v", got, want)
+	}
+}
+
+func TestFragmentWriter(t *testing.T) {
+	var sizes []int
+	w := FragmentWriter(writerFunc(func(p []byte) (int, error) {
+		sizes = append(sizes, len(p))
+		return len(p), nil
+	}), 2)
+	n, err := w.Write([]byte("abcde"))
+	if n != 5 || err != nil {
+		t.Fatalf("Write() = %d, %v, want 5, nil", n, err)
+	}
+	if want := []int{2, 2, 1}; !equalInts(sizes, want) {
+		t.Errorf("write sizes = %v, want %v", sizes, want)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	data := []byte("abcdef")
+	got, err := ioutil.ReadAll(CorruptReader(FragmentReader(bytes.NewReader(data), 2), 3, 0xff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{'a', 'b', 'c', 'd' ^ 0xff, 'e', 'f'}; !bytes.Equal(got, want) {
+		t.Errorf("CorruptReader = %q, want %q", got, want)
+	}
+	var buf bytes.Buffer
+	w := CorruptWriter(FragmentWriter(&buf, 2), 0, 0x01)
+	w.Write(data[:1])
+	w.Write(data[1:])
+	if want := []byte("`bcdef"); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("CorruptWriter = %q, want %q", buf.Bytes(), want)
+	}
+	if !bytes.Equal(data, []byte("abcdef")) {
+		t.Error("CorruptWriter modified the input")
+	}
+}
+
+func TestFail(t *testing.T) {
+	errTest := errors.New("test")
+	got, err := ioutil.ReadAll(FailReader(bytes.NewReader([]byte("abcdef")), 4, errTest))
+	if err != errTest || string(got) != "abcd" {
+		t.Errorf("FailReader = %q, %v, want %q, %v", got, err, "abcd", errTest)
+	}
+	var buf bytes.Buffer
+	w := FailWriter(&buf, 3, nil)
+	if n, err := w.Write([]byte("ab")); n != 2 || err != nil {
+		t.Errorf("Write() = %d, %v, want 2, nil", n, err)
+	}
+	if n, err := w.Write([]byte("cd")); n != 1 || err != ErrInjected {
+		t.Errorf("Write() = %d, %v, want 1, %v", n, err, ErrInjected)
+	}
+	if buf.String() != "abc" {
+		t.Errorf("written %q, want %q", buf.String(), "abc")
+	}
+}
+
+// stream returns the conio stream with data written in separate frames.
+func stream(t *testing.T, w io.Writer, data ...string) {
+	t.Helper()
+	cw := conio.NewWriter(w)
+	for _, d := range data {
+		if _, err := io.WriteString(cw, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDropClosed(t *testing.T) {
+	var full bytes.Buffer
+	stream(t, &full, "hello", "world")
+	full.WriteString("trailing")
+	want := full.Bytes()[:2*4+10]
+
+	for _, n := range []int{1, 3, 1024} {
+		got, err := ioutil.ReadAll(DropClosedReader(FragmentReader(bytes.NewReader(full.Bytes()), n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("DropClosedReader(%d) = %q, want %q", n, got, want)
+		}
+		var buf bytes.Buffer
+		w := FragmentWriter(DropClosedWriter(&buf), n)
+		if n, err := w.Write(full.Bytes()); n != full.Len() || err != nil {
+			t.Errorf("Write() = %d, %v, want %d, nil", n, err, full.Len())
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("DropClosedWriter(%d) = %q, want %q", n, buf.Bytes(), want)
+		}
+	}
+
+	// the reader sees the stream without the closed header.
+	r := conio.NewReader(DropClosedReader(bytes.NewReader(full.Bytes())))
+	got, err := ioutil.ReadAll(r)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ConReader error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if string(got) != "helloworld" || r.Stats().Closed {
+		t.Errorf("ConReader = %q, closed %v, want %q, false", got, r.Stats().Closed, "helloworld")
+	}
+
+	// the truncated header is passed through.
+	got, err = ioutil.ReadAll(DropClosedReader(bytes.NewReader(want[:2])))
+	if err != nil || !bytes.Equal(got, want[:2]) {
+		t.Errorf("DropClosedReader(truncated) = %q, %v, want %q, nil", got, err, want[:2])
+	}
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,298 @@
+package conioitest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/rusq/conio"
+)
+
+// Framer creates the writer and reader of the framed stream.  The data
+// written to the writer returned by NewWriter, once it is closed, must be
+// read back by the reader returned by NewReader from the bytes written.  If
+// the reader implements io.Closer, it is closed after use.
+type Framer interface {
+	NewWriter(w io.Writer) io.WriteCloser
+	NewReader(r io.Reader) io.Reader
+}
+
+// Conio returns the Framer that creates ConWriter and ConReader with the
+// options opts.
+func Conio(opts ...conio.Option) Framer {
+	return conioFramer(opts)
+}
+
+type conioFramer []conio.Option
+
+func (f conioFramer) NewWriter(w io.Writer) io.WriteCloser { return conio.NewWriter(w, f...) }
+func (f conioFramer) NewReader(r io.Reader) io.Reader      { return conio.NewReader(r, f...) }
+
+// readTimeout is the time the reader has to read the stream in the suite.
+const readTimeout = 10 * time.Second
+
+// TestFramer runs the conformance suite against the Framer f.  It checks
+// that:
+//
+//   - the data round-trips with any fragmentation of reads and writes;
+//   - the errors of the underlying writer and reader are returned, and
+//     can be matched with errors.Is;
+//   - the truncated stream, or the stream without the end of stream
+//     header, yields the prefix of the data written, and the error that
+//     reports the truncation;
+//   - the corrupted stream does not panic or hang the reader.
+func TestFramer(t *testing.T, f Framer) {
+	t.Run("RoundTrip", func(t *testing.T) { testRoundTrip(t, f) })
+	t.Run("WriterFailure", func(t *testing.T) { testWriterFailure(t, f) })
+	t.Run("ReaderFailure", func(t *testing.T) { testReaderFailure(t, f) })
+	t.Run("Truncated", func(t *testing.T) { testTruncated(t, f) })
+	t.Run("DropClosed", func(t *testing.T) { testDropClosed(t, f) })
+	t.Run("Corrupted", func(t *testing.T) { testCorrupted(t, f) })
+}
+
+// payloads are the sequences of writes used by the suite.
+var payloads = []struct {
+	name   string
+	writes [][]byte
+}{
+	{"empty", nil},
+	{"one byte", [][]byte{{42}}},
+	{"single", [][]byte{bytes.Repeat([]byte("conio"), 1000)}},
+	{"many", [][]byte{[]byte("a"), []byte("bc"), {}, bytes.Repeat([]byte{0}, 4096), []byte("def")}},
+	{"large", [][]byte{bytes.Repeat([]byte("0123456789abcdef"), 1<<14)}},
+}
+
+// encode writes the writes to the framer writer over the transport
+// wrap, and returns the stream.
+func encode(t *testing.T, f Framer, wrap func(io.Writer) io.Writer, writes [][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := f.NewWriter(wrap(&buf))
+	for _, p := range writes {
+		if _, err := w.Write(p); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// decode reads the stream with the framer reader until the error, and fails
+// the test if the reader does not return in readTimeout, or panics.
+func decode(t *testing.T, f Framer, r io.Reader) ([]byte, error) {
+	t.Helper()
+	type result struct {
+		data []byte
+		err  error
+		pv   interface{}
+	}
+	resc := make(chan result, 1)
+	fr := f.NewReader(r)
+	go func() {
+		var res result
+		defer func() {
+			res.pv = recover()
+			resc <- res
+		}()
+		res.data, res.err = readAll(fr)
+	}()
+	defer func() {
+		if c, ok := fr.(io.Closer); ok {
+			c.Close()
+		}
+	}()
+	select {
+	case res := <-resc:
+		if res.pv != nil {
+			t.Fatalf("reader panics: %v", res.pv)
+		}
+		return res.data, res.err
+	case <-time.After(readTimeout):
+		t.Fatalf("reader does not return in %s", readTimeout)
+		return nil, nil
+	}
+}
+
+// readAll is io.ReadAll, that returns io.EOF as nil, and gives up if the
+// reader makes no progress.
+func readAll(r io.Reader) ([]byte, error) {
+	var (
+		buf   bytes.Buffer
+		p     = make([]byte, 4096)
+		empty int
+	)
+	for {
+		n, err := r.Read(p)
+		buf.Write(p[:n])
+		if err == io.EOF {
+			return buf.Bytes(), nil
+		} else if err != nil {
+			return buf.Bytes(), err
+		}
+		if n > 0 {
+			empty = 0
+			continue
+		}
+		empty++
+		if empty > 100 {
+			return buf.Bytes(), io.ErrNoProgress
+		}
+	}
+}
+
+func concat(writes [][]byte) []byte {
+	return bytes.Join(writes, nil)
+}
+
+// checkPrefix checks that got is the prefix of want.
+func checkPrefix(t *testing.T, got, want []byte) {
+	t.Helper()
+	if !bytes.HasPrefix(want, got) {
+		t.Errorf("data read (%d bytes) is not the prefix of the data written (%d bytes)", len(got), len(want))
+	}
+}
+
+func testRoundTrip(t *testing.T, f Framer) {
+	writers := []struct {
+		name string
+		wrap func(io.Writer) io.Writer
+	}{
+		{"plain", func(w io.Writer) io.Writer { return w }},
+		{"fragmented", func(w io.Writer) io.Writer { return FragmentWriter(w, 3) }},
+	}
+	readers := []struct {
+		name string
+		wrap func(io.Reader) io.Reader
+	}{
+		{"plain", func(r io.Reader) io.Reader { return r }},
+		{"one byte", iotest.OneByteReader},
+		{"half", iotest.HalfReader},
+		{"data err", iotest.DataErrReader},
+		{"fragmented", func(r io.Reader) io.Reader { return FragmentReader(r, 7) }},
+		{"delayed", func(r io.Reader) io.Reader { return DelayReader(FragmentReader(r, 1<<14), time.Microsecond) }},
+	}
+	for _, pl := range payloads {
+		want := concat(pl.writes)
+		for _, w := range writers {
+			stream := encode(t, f, w.wrap, pl.writes)
+			for _, r := range readers {
+				t.Run(fmt.Sprintf("%s/%s/%s", pl.name, w.name, r.name), func(t *testing.T) {
+					got, err := decode(t, f, r.wrap(bytes.NewReader(stream)))
+					if err != nil {
+						t.Fatalf("read error = %v", err)
+					}
+					if !bytes.Equal(got, want) {
+						t.Errorf("read %d bytes, want %d bytes", len(got), len(want))
+					}
+				})
+			}
+		}
+	}
+}
+
+// cuts returns up to max offsets within the stream of size sz, including
+// the ones around the first header.
+func cuts(sz int, max int) []int64 {
+	var offs []int64
+	for i := 0; i < sz && i <= hdrSz+1; i++ {
+		offs = append(offs, int64(i))
+	}
+	step := sz / max
+	if step < 1 {
+		step = 1
+	}
+	for i := hdrSz + 2; i < sz; i += step {
+		offs = append(offs, int64(i))
+	}
+	if sz > 0 {
+		offs = append(offs, int64(sz-1))
+	}
+	return offs
+}
+
+func testWriterFailure(t *testing.T, f Framer) {
+	writes := payloads[3].writes
+	stream := encode(t, f, func(w io.Writer) io.Writer { return w }, writes)
+	for _, n := range cuts(len(stream), 16) {
+		t.Run(fmt.Sprintf("after %d", n), func(t *testing.T) {
+			w := f.NewWriter(FailWriter(io.Discard, n, nil))
+			var err error
+			for _, p := range writes {
+				if _, err = w.Write(p); err != nil {
+					break
+				}
+			}
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+			if !errors.Is(err, ErrInjected) {
+				t.Errorf("error = %v, want %v", err, ErrInjected)
+			}
+		})
+	}
+}
+
+func testReaderFailure(t *testing.T, f Framer) {
+	writes := payloads[3].writes
+	stream := encode(t, f, func(w io.Writer) io.Writer { return w }, writes)
+	for _, n := range cuts(len(stream), 16) {
+		t.Run(fmt.Sprintf("after %d", n), func(t *testing.T) {
+			got, err := decode(t, f, FailReader(bytes.NewReader(stream), n, nil))
+			if !errors.Is(err, ErrInjected) {
+				t.Errorf("error = %v, want %v", err, ErrInjected)
+			}
+			checkPrefix(t, got, concat(writes))
+		})
+	}
+}
+
+func testTruncated(t *testing.T, f Framer) {
+	writes := payloads[3].writes
+	stream := encode(t, f, func(w io.Writer) io.Writer { return w }, writes)
+	for _, n := range cuts(len(stream), 32) {
+		t.Run(fmt.Sprintf("at %d", n), func(t *testing.T) {
+			got, err := decode(t, f, bytes.NewReader(stream[:n]))
+			if err == nil {
+				t.Error("read error = nil, want the truncation error")
+			}
+			checkPrefix(t, got, concat(writes))
+		})
+	}
+}
+
+func testDropClosed(t *testing.T, f Framer) {
+	for _, pl := range payloads {
+		t.Run(pl.name, func(t *testing.T) {
+			stream := encode(t, f, func(w io.Writer) io.Writer { return w }, pl.writes)
+			got, err := decode(t, f, DropClosedReader(bytes.NewReader(stream)))
+			if err == nil {
+				t.Error("read error = nil, want the truncation error")
+			}
+			checkPrefix(t, got, concat(pl.writes))
+
+			dropped := encode(t, f, DropClosedWriter, pl.writes)
+			got, err = decode(t, f, bytes.NewReader(dropped))
+			if err == nil {
+				t.Error("read error = nil, want the truncation error")
+			}
+			checkPrefix(t, got, concat(pl.writes))
+		})
+	}
+}
+
+func testCorrupted(t *testing.T, f Framer) {
+	writes := payloads[3].writes
+	stream := encode(t, f, func(w io.Writer) io.Writer { return w }, writes)
+	for _, off := range cuts(len(stream), 32) {
+		t.Run(fmt.Sprintf("at %d", off), func(t *testing.T) {
+			// the result is not defined, as long as the reader returns.
+			decode(t, f, CorruptReader(bytes.NewReader(stream), off, 0x01))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package conio
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+)
+
+// Direction is the direction of the ConConn stream.
+type Direction int
+
+const (
+	DirRead  Direction = 1 << iota // incoming stream
+	DirWrite                       // outgoing stream
+
+	DirBoth = DirRead | DirWrite // both directions
+)
+
+var (
+	errStreamActive = errors.New("stream is already active")
+	errNoStream     = errors.New("stream is not active")
+)
+
+// ConConn is the net.Conn that switches between raw and framed modes.  In raw
+// mode, reads and writes go directly to the underlying connection.  Between
+// BeginStream and EndStream, the data in the given direction is framed with
+// ConReader or ConWriter.
+//
+// The framed reader never consumes bytes past the closed header of the
+// stream, so that the raw data that follows it can be read with the buffered
+// readers or decoders after EndStream.
+//
+// Deadlines and addresses are those of the underlying connection.  The read
+// of the incoming stream interrupted by the deadline can be retried, the
+// frame read in part is resumed.  If the frames are read ahead, that is, if
+// the stream is compressed or WithPrefetch is set, the read error, including
+// the timeout, ends the stream.
+type ConConn struct {
+	net.Conn
+	opts []Option
+
+	rmu sync.Mutex // guards r
+	r   *ConReader // incoming stream, if active
+
+	wmu sync.Mutex // guards w
+	w   *ConWriter // outgoing stream, if active
+}
+
+var _ net.Conn = (*ConConn)(nil)
+
+// NewConn wraps the connection c.  The options are applied to the streams'
+// readers and writers.
+func NewConn(c net.Conn, opts ...Option) *ConConn {
+	return &ConConn{Conn: c, opts: opts}
+}
+
+// BeginStream switches the given direction into framed mode.  For DirWrite,
+// subsequent writes are framed.  For DirRead, subsequent reads return the
+// data of the incoming stream, and io.EOF once it is closed, until
+// EndStream is called.
+func (c *ConConn) BeginStream(dir Direction) error {
+	if dir&DirRead != 0 {
+		c.rmu.Lock()
+		defer c.rmu.Unlock()
+		if c.r != nil {
+			return errStreamActive
+		}
+	}
+	if dir&DirWrite != 0 {
+		c.wmu.Lock()
+		defer c.wmu.Unlock()
+		if c.w != nil {
+			return errStreamActive
+		}
+	}
+	if dir&DirRead != 0 {
+		c.r = NewReader(c.Conn, c.opts...)
+	}
+	if dir&DirWrite != 0 {
+		c.w = NewWriter(c.Conn, c.opts...)
+	}
+	return nil
+}
+
+// EndStream switches the given direction back into raw mode.  For DirWrite,
+// it closes the outgoing stream.  For DirRead, it discards the unread data of
+// the incoming stream up to its closed header.
+func (c *ConConn) EndStream(dir Direction) error {
+	if dir&DirRead != 0 {
+		c.rmu.Lock()
+		defer c.rmu.Unlock()
+		if c.r == nil {
+			return errNoStream
+		}
+	}
+	if dir&DirWrite != 0 {
+		c.wmu.Lock()
+		defer c.wmu.Unlock()
+		if c.w == nil {
+			return errNoStream
+		}
+	}
+	var err error
+	if dir&DirWrite != 0 {
+		err = c.w.Close()
+		c.w = nil
+	}
+	if dir&DirRead != 0 {
+		if _, rerr := io.Copy(ioutil.Discard, c.r); rerr != nil && err == nil {
+			err = rerr
+		}
+		c.r.Close()
+		c.r = nil
+	}
+	return err
+}
+
+// Read reads from the incoming stream if it is active, or from the
+// underlying connection otherwise.
+func (c *ConConn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	r := c.r
+	c.rmu.Unlock()
+	if r != nil {
+		return r.Read(p)
+	}
+	return c.Conn.Read(p)
+}
+
+// Write writes to the outgoing stream if it is active, or to the underlying
+// connection otherwise.
+func (c *ConConn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	w := c.w
+	c.wmu.Unlock()
+	if w != nil {
+		return w.Write(p)
+	}
+	return c.Conn.Write(p)
+}
+
+// Close closes the underlying connection, and stops the background
+// goroutines of the active streams.  The active outgoing stream is not
+// closed gracefully.
+func (c *ConConn) Close() error {
+	err := c.Conn.Close()
+	c.rmu.Lock()
+	if c.r != nil {
+		c.r.Close()
+	}
+	c.rmu.Unlock()
+	c.wmu.Lock()
+	if c.w != nil {
+		c.w.Close()
+	}
+	c.wmu.Unlock()
+	return err
+}
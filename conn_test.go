@@ -0,0 +1,173 @@
+package conio
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConConn(t *testing.T) {
+	data := testText(100000)
+	client, server := net.Pipe()
+	cc, sc := NewConn(client), NewConn(server)
+	defer cc.Close()
+	defer sc.Close()
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- func() error {
+			if _, err := io.WriteString(sc, "hello\n"); err != nil {
+				return err
+			}
+			if err := sc.BeginStream(DirWrite); err != nil {
+				return err
+			}
+			if _, err := sc.Write(data); err != nil {
+				return err
+			}
+			if err := sc.EndStream(DirWrite); err != nil {
+				return err
+			}
+			_, err := io.WriteString(sc, "bye\n")
+			return err
+		}()
+	}()
+
+	p := make([]byte, 6)
+	if _, err := io.ReadFull(cc, p); err != nil || string(p) != "hello\n" {
+		t.Fatalf("raw read = %q, %v, want %q", p, err, "hello\n")
+	}
+	if err := cc.BeginStream(DirRead); err != nil {
+		t.Fatalf("ConConn.BeginStream() error = %v", err)
+	}
+	if err := cc.BeginStream(DirRead); err != errStreamActive {
+		t.Errorf("ConConn.BeginStream() error = %v, want %v", err, errStreamActive)
+	}
+	got, err := ioutil.ReadAll(cc)
+	if err != nil {
+		t.Fatalf("stream read error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("stream read %d bytes, different from %d bytes sent", len(got), len(data))
+	}
+	if err := cc.EndStream(DirRead); err != nil {
+		t.Fatalf("ConConn.EndStream() error = %v", err)
+	}
+	// nothing past the closed header has been consumed.
+	line, err := bufio.NewReader(cc).ReadString('\n')
+	if err != nil || line != "bye\n" {
+		t.Errorf("raw read = %q, %v, want %q", line, err, "bye\n")
+	}
+	if err := <-errC; err != nil {
+		t.Errorf("server error = %v", err)
+	}
+	if err := cc.EndStream(DirRead); err != errNoStream {
+		t.Errorf("ConConn.EndStream() error = %v, want %v", err, errNoStream)
+	}
+}
+
+func TestConConn_EndStreamDrains(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"prefetch", []Option{WithPrefetch(4, 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			cc, sc := NewConn(client, tt.opts...), NewConn(server, tt.opts...)
+			defer cc.Close()
+			defer sc.Close()
+
+			go func() {
+				sc.BeginStream(DirWrite)
+				for i := 0; i < 10; i++ {
+					sc.Write([]byte("frame"))
+				}
+				sc.EndStream(DirWrite)
+				io.WriteString(sc, "raw")
+			}()
+
+			cc.BeginStream(DirRead)
+			p := make([]byte, 3)
+			if _, err := cc.Read(p); err != nil {
+				t.Fatalf("stream read error = %v", err)
+			}
+			if err := cc.EndStream(DirRead); err != nil {
+				t.Fatalf("ConConn.EndStream() error = %v", err)
+			}
+			if _, err := io.ReadFull(cc, p); err != nil || string(p) != "raw" {
+				t.Errorf("raw read = %q, %v, want %q", p, err, "raw")
+			}
+		})
+	}
+}
+
+// TestConConn_deadline checks that the read of the incoming stream
+// interrupted by the deadline in the middle of the frame can be retried.
+func TestConConn_deadline(t *testing.T) {
+	var buf bytes.Buffer
+	writeStream(t, NewWriter(&buf, WithSizeHint(5)), "hello")
+	stream := buf.Bytes()
+	payload := bytes.Index(stream, []byte("hello"))
+	tests := []struct {
+		name string
+		cut  int
+	}{
+		{"in control header", 2},
+		{"in control payload", hdrSz + 3},
+		{"in header", payload - 2},
+		{"in payload", payload + 2},
+		{"in closed header", len(stream) - 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+			cc := NewConn(client)
+			if err := cc.BeginStream(DirRead); err != nil {
+				t.Fatal(err)
+			}
+			resume := make(chan struct{})
+			go func() {
+				server.Write(stream[:tt.cut])
+				<-resume
+				server.Write(stream[tt.cut:])
+			}()
+
+			if err := cc.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+				t.Fatal(err)
+			}
+			var got []byte
+			p := make([]byte, 16)
+			for {
+				n, err := cc.Read(p)
+				got = append(got, p[:n]...)
+				if err != nil {
+					if !errors.Is(err, os.ErrDeadlineExceeded) {
+						t.Fatalf("Read() error = %v, want %v", err, os.ErrDeadlineExceeded)
+					}
+					break
+				}
+			}
+			cc.SetReadDeadline(time.Now().Add(5 * time.Second))
+			close(resume)
+			rest, err := ioutil.ReadAll(cc)
+			if err != nil {
+				t.Fatalf("Read() after the timeout error = %v", err)
+			}
+			if got = append(got, rest...); string(got) != "hello" {
+				t.Errorf("data = %q, want %q", got, "hello")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package conio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// control frame kinds.  A control frame is a frame with the closed bit set
+// and a non-zero size.  The first byte of its payload is the kind, the rest
+// is kind-specific.
+const (
+	ctlAck      byte = iota + 1 // acknowledgement, sent by the receiving side
+	ctlCompress                 // data frames that follow are compressed
+	ctlSizeHint                 // total size of the stream data
+	ctlChecksum                 // the stream ends with the trailer
+	ctlTrailer                  // byte count and checksum of the stream data
+	ctlFrameSum                 // checksum of the preceding data frame
+)
+
+// maxCtlSz is the maximum size of the control frame payload.
+const maxCtlSz = 1 << 16
+
+var (
+	errUnknownControl = errors.New("unknown control frame")
+	errInvalidControl = errors.New("invalid control frame")
+)
+
+// ctlFrame returns the serialised control frame of the given kind with the
+// payload body, including the header.
+func ctlFrame(kind byte, body []byte) []byte {
+	buf := make([]byte, hdrSz+1+len(body))
+	copy(buf, must(newBinHeader(1+len(body), true)).Bytes())
+	buf[hdrSz] = kind
+	copy(buf[hdrSz+1:], body)
+	return buf
+}
+
+// readControl reads the control frame payload of the given size from r.  The
+// end of r before the payload is complete is io.ErrUnexpectedEOF.
+func readControl(r io.Reader, size int) ([]byte, error) {
+	if size > maxCtlSz {
+		return nil, fmt.Errorf("%w: size %d", errInvalidControl, size)
+	}
+	p := make([]byte, size)
+	if _, err := io.ReadFull(r, p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// control processes the control frame payload p received in the stream.
+func (r *ConReader) control(p []byte) error {
+	switch p[0] {
+	case ctlCompress:
+		c, err := loadCodec(p[1:])
+		if err != nil {
+			return err
+		}
+		if r.codec != nil {
+			return fmt.Errorf("%w: compression is already set", errInvalidControl)
+		}
+		r.codec = c
+		return nil
+	case ctlSizeHint:
+		n, err := loadSizeHint(p[1:])
+		if err != nil {
+			return err
+		}
+		r.setExpectedSize(n)
+		return nil
+	case ctlChecksum:
+		if err := loadChecksum(p[1:]); err != nil {
+			return err
+		}
+		r.sumData()
+		return nil
+	case ctlTrailer:
+		t, err := loadTrailer(p[1:])
+		if err != nil {
+			return err
+		}
+		if r.trailer != nil {
+			return fmt.Errorf("%w: duplicate trailer", errInvalidControl)
+		}
+		r.trailer = &t
+		return nil
+	case ctlFrameSum:
+		sum, err := loadFrameSum(p[1:])
+		if err != nil {
+			return err
+		}
+		return r.checkFrameSum(sum)
+	default:
+		return fmt.Errorf("%w: kind %d", errUnknownControl, p[0])
+	}
+}
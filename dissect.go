@@ -0,0 +1,279 @@
+package conio
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// SegmentKind is the kind of the dissected segment of the stream.
+type SegmentKind int
+
+// segment kinds.
+const (
+	SegHeader   SegmentKind = iota // frame header
+	SegPayload                     // frame payload
+	SegTrailing                    // data after the closed header
+)
+
+var segmentKinds = [...]string{
+	SegHeader:   "header",
+	SegPayload:  "payload",
+	SegTrailing: "trailing",
+}
+
+func (k SegmentKind) String() string {
+	if k < 0 || int(k) >= len(segmentKinds) {
+		return fmt.Sprintf("SegmentKind(%d)", int(k))
+	}
+	return segmentKinds[k]
+}
+
+// Segment is the contiguous part of the stream:  a frame header, a frame
+// payload, or the trailing data.
+type Segment struct {
+	Kind   SegmentKind
+	Offset int64 // offset of the segment in the input
+	Size   int64 // size of the segment
+	// Data is the raw bytes of the segment.  It holds the first bytes only,
+	// if the segment is larger than the limit passed to Dissect.
+	Data []byte
+	// Frame is the frame the header or payload belongs to.  It is the zero
+	// Frame for the trailing data.
+	Frame Frame
+}
+
+// DissectError is the error in the stream found by Dissect.
+type DissectError struct {
+	Offset   int64  // offset of the error in the input
+	Expected string // what was expected at the offset
+	Err      error  // the underlying error
+}
+
+func (e *DissectError) Error() string {
+	return fmt.Sprintf("offset %d: expected %s: %v", e.Offset, e.Expected, e.Err)
+}
+
+func (e *DissectError) Unwrap() error {
+	return e.Err
+}
+
+// Dissection is the result of Dissect.
+type Dissection struct {
+	Segments []Segment
+	// Err is the error found in the stream, or nil if the stream is well
+	// formed.  The segments that precede the error are complete, and the
+	// last segment may be partial.
+	Err *DissectError
+}
+
+// Dissect walks the raw stream read from r, up to the closed header, and
+// splits it into headers and payloads of the frames, decoding each header
+// and control frame.  The data after the closed header, if any, is not
+// interpreted, and is returned as the trailing segment.  Dissect does not
+// decompress the data and does not verify the checksum.  It is a debugging
+// aid for the streams produced by other implementations, see
+// Dissection.Dump.
+//
+// If limit is positive, at most limit bytes of each payload and of the
+// trailing data are kept in Segment.Data, and the rest is read and
+// discarded, so that the memory used does not depend on the size of the
+// stream.
+//
+// If the stream is malformed, Dissect returns the segments up to the error,
+// and the error in Dissection.Err.  The returned error is only set if r
+// fails with an error other than io.EOF.
+func Dissect(r io.Reader, limit int) (*Dissection, error) {
+	var (
+		d   Dissection
+		off int64
+		idx int64
+	)
+	// fail records the premature end of input after the partial segment
+	// of size bytes, if any.  Other read errors are returned as is.
+	fail := func(kind SegmentKind, f Frame, data []byte, size int64, expected string, err error) (*Dissection, error) {
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return &d, err
+		}
+		err = io.ErrUnexpectedEOF
+		if size > 0 {
+			d.Segments = append(d.Segments, Segment{Kind: kind, Offset: off, Size: size, Data: data, Frame: f})
+		}
+		d.Err = &DissectError{Offset: off + size, Expected: expected, Err: err}
+		return &d, nil
+	}
+	for {
+		var hdrBuf [hdrSz]byte
+		n, err := io.ReadFull(r, hdrBuf[:])
+		if err != nil {
+			if n == 0 {
+				return fail(SegHeader, Frame{}, nil, 0, "frame header or closed header", err)
+			}
+			return fail(SegHeader, Frame{}, hdrBuf[:n], int64(n), fmt.Sprintf("%d header bytes, got %d", hdrSz, n), err)
+		}
+		hdr := must(loadHeader(hdrBuf[:]))
+		f := Frame{
+			Index:  idx,
+			Offset: off,
+			Size:   hdr.Size(),
+			Closed: hdr.IsClosed(),
+			Type:   frameType(hdr),
+		}
+		idx++
+		d.Segments = append(d.Segments, Segment{Kind: SegHeader, Offset: off, Size: hdrSz, Data: hdrBuf[:], Frame: f})
+		off += hdrSz
+
+		if f.Type == FrameClosed {
+			break
+		}
+		if f.Type == FrameControl && f.Size > maxCtlSz {
+			d.Err = &DissectError{
+				Offset:   f.Offset,
+				Expected: fmt.Sprintf("control frame of at most %d bytes, header declares %d", maxCtlSz, f.Size),
+				Err:      errInvalidControl,
+			}
+			return &d, nil
+		}
+		if f.Size == 0 {
+			continue
+		}
+		// the control frame payload is small, and is kept to be decoded.
+		keep := limit
+		if f.Type == FrameControl {
+			keep = 0
+		}
+		data, m, err := readSegment(r, int64(f.Size), keep)
+		if err != nil {
+			return fail(SegPayload, f, clip(data, limit), m, fmt.Sprintf("payload of %d bytes, got %d", f.Size, m), err)
+		}
+		seg := Segment{Kind: SegPayload, Offset: off, Size: m, Data: clip(data, limit), Frame: f}
+		if f.Type == FrameControl {
+			f.Payload = data
+			var err error
+			f.Kind, f.Detail, err = describeControl(f.Payload)
+			seg.Frame = f
+			if err != nil {
+				d.Segments = append(d.Segments, seg)
+				d.Err = &DissectError{Offset: off, Expected: "valid control frame", Err: err}
+				return &d, nil
+			}
+			d.Segments[len(d.Segments)-1].Frame = f
+		}
+		d.Segments = append(d.Segments, seg)
+		off += int64(f.Size)
+	}
+
+	data, m, err := readSegment(r, -1, limit)
+	if err != nil && err != io.EOF {
+		return &d, err
+	}
+	if m > 0 {
+		d.Segments = append(d.Segments, Segment{Kind: SegTrailing, Offset: off, Size: m, Data: data})
+	}
+	return &d, nil
+}
+
+// readSegment reads the segment of size bytes from r, or until the end of r,
+// if size is negative.  It returns the first limit bytes of the segment, or
+// all of it, if limit is not positive, and the number of bytes read.  The
+// segment that ends prematurely is reported with io.EOF.
+func readSegment(r io.Reader, size int64, limit int) ([]byte, int64, error) {
+	src := r
+	if size >= 0 {
+		src = io.LimitReader(r, size)
+	}
+	head := src
+	if limit > 0 {
+		head = io.LimitReader(src, int64(limit))
+	}
+	data, err := ioutil.ReadAll(head)
+	n := int64(len(data))
+	if err == nil {
+		var m int64
+		m, err = io.Copy(ioutil.Discard, src)
+		n += m
+	}
+	if err == nil && size >= 0 && n < size {
+		err = io.EOF
+	}
+	return data, n, err
+}
+
+// clip returns the first limit bytes of p, if limit is positive.
+func clip(p []byte, limit int) []byte {
+	if limit > 0 && len(p) > limit {
+		return p[:limit]
+	}
+	return p
+}
+
+// dumpWidth is the number of bytes in the line of the hex dump.
+const dumpWidth = 16
+
+// Dump writes the annotated hex dump of the dissected stream to w.  Each
+// segment starts on a new line, with the offset, the segment kind and, on
+// the first line, the description of the frame.  The segment that is
+// larger than the limit passed to Dissect is followed by the number of
+// bytes omitted.  If the stream is malformed, the dump ends with the error.
+func (d *Dissection) Dump(w io.Writer) error {
+	for _, s := range d.Segments {
+		data := s.Data
+		note := s.describe()
+		for i := 0; i < len(data); i += dumpWidth {
+			line := data[i:]
+			if len(line) > dumpWidth {
+				line = line[:dumpWidth]
+			}
+			out := fmt.Sprintf("%08x  %-8s  %-*s |%-*s|  %s",
+				s.Offset+int64(i), s.Kind, dumpWidth*3-1, fmt.Sprintf("% x", line), dumpWidth, printable(line), note)
+			if _, err := fmt.Fprintln(w, strings.TrimRight(out, " ")); err != nil {
+				return err
+			}
+			note = ""
+		}
+		if more := s.Size - int64(len(data)); more > 0 {
+			if _, err := fmt.Fprintf(w, "%08x  %-8s  ... %d more bytes\n", s.Offset+int64(len(data)), s.Kind, more); err != nil {
+				return err
+			}
+		}
+	}
+	if d.Err != nil {
+		if _, err := fmt.Fprintf(w, "%08x  error     expected %s: %v\n", d.Err.Offset, d.Err.Expected, d.Err.Err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describe returns the annotation of the segment.
+func (s Segment) describe() string {
+	f := s.Frame
+	switch s.Kind {
+	case SegHeader:
+		desc := fmt.Sprintf("frame %d: %s, size %d", f.Index, f.Type, f.Size)
+		if f.Closed && f.Type != FrameClosed {
+			desc += ", closed"
+		}
+		return desc
+	case SegPayload:
+		if f.Kind != "" {
+			return strings.TrimSpace(f.Kind + " " + f.Detail)
+		}
+		return fmt.Sprintf("frame %d: %d bytes", f.Index, s.Size)
+	}
+	return fmt.Sprintf("%d bytes after the closed header", s.Size)
+}
+
+// printable returns the ASCII representation of p, with non-printable
+// characters replaced by dots.
+func printable(p []byte) string {
+	b := make([]byte, len(p))
+	for i, c := range p {
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+		b[i] = c
+	}
+	return string(b)
+}
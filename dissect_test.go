@@ -0,0 +1,153 @@
+package conio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDissect(t *testing.T) {
+	closed := must(newBinHeader(0, true)).Bytes()
+	frame := append(must(newBinHeader(3, false)).Bytes(), 1, 2, 3)
+	cat := func(pp ...[]byte) []byte { return bytes.Join(pp, nil) }
+	type seg struct {
+		Kind   SegmentKind
+		Offset int64
+		Size   int64
+	}
+	tests := []struct {
+		name       string
+		input      []byte
+		want       []seg
+		wantOffset int64 // offset of the error, or -1
+		wantErr    error
+	}{
+		{"stream", cat(sizeHintFrame(3), frame, closed),
+			[]seg{{SegHeader, 0, 4}, {SegPayload, 4, 9}, {SegHeader, 13, 4}, {SegPayload, 17, 3}, {SegHeader, 20, 4}},
+			-1, nil},
+		{"trailing", cat(frame, closed, []byte("GET /")),
+			[]seg{{SegHeader, 0, 4}, {SegPayload, 4, 3}, {SegHeader, 7, 4}, {SegTrailing, 11, 5}},
+			-1, nil},
+		{"heartbeat", cat([]byte{0, 0, 0, 0}, closed),
+			[]seg{{SegHeader, 0, 4}, {SegHeader, 4, 4}},
+			-1, nil},
+		{"empty", nil, nil, 0, io.ErrUnexpectedEOF},
+		{"no closed header", frame,
+			[]seg{{SegHeader, 0, 4}, {SegPayload, 4, 3}},
+			7, io.ErrUnexpectedEOF},
+		{"partial header", cat(frame, []byte{0, 0}),
+			[]seg{{SegHeader, 0, 4}, {SegPayload, 4, 3}, {SegHeader, 7, 2}},
+			9, io.ErrUnexpectedEOF},
+		{"partial payload", frame[:5],
+			[]seg{{SegHeader, 0, 4}, {SegPayload, 4, 1}},
+			5, io.ErrUnexpectedEOF},
+		{"unknown control", cat(ctlFrame(0x7f, nil), closed),
+			[]seg{{SegHeader, 0, 4}, {SegPayload, 4, 1}},
+			4, errUnknownControl},
+		{"huge control", []byte{0xff, 0xff, 0xff, 0xff},
+			[]seg{{SegHeader, 0, 4}},
+			0, errInvalidControl},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Dissect(bytes.NewReader(tt.input), 0)
+			if err != nil {
+				t.Fatalf("Dissect() error = %v", err)
+			}
+			var got []seg
+			for _, s := range d.Segments {
+				got = append(got, seg{s.Kind, s.Offset, s.Size})
+				if int64(len(s.Data)) != s.Size {
+					t.Errorf("segment at %d: %d bytes of data, want %d", s.Offset, len(s.Data), s.Size)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("segments = %v, want %v", got, tt.want)
+			}
+			if tt.wantOffset < 0 {
+				if d.Err != nil {
+					t.Errorf("Dissection.Err = %v, want nil", d.Err)
+				}
+				return
+			}
+			if d.Err == nil {
+				t.Fatal("Dissection.Err = nil, want error")
+			}
+			if d.Err.Offset != tt.wantOffset || !errors.Is(d.Err, tt.wantErr) {
+				t.Errorf("Dissection.Err = %v, want %v at %d", d.Err, tt.wantErr, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestDissect_limit(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 1000)
+	input := bytes.Join([][]byte{
+		must(newBinHeader(len(payload), false)).Bytes(),
+		payload,
+		must(newBinHeader(0, true)).Bytes(),
+		[]byte("trailing data"),
+	}, nil)
+	type seg struct {
+		Kind SegmentKind
+		Size int64
+		Len  int
+	}
+	want := []seg{{SegHeader, 4, 4}, {SegPayload, 1000, 8}, {SegHeader, 4, 4}, {SegTrailing, 13, 8}}
+	for _, cut := range []int{len(input), 500} {
+		d, err := Dissect(bytes.NewReader(input[:cut]), 8)
+		if err != nil {
+			t.Fatalf("Dissect() error = %v", err)
+		}
+		var got []seg
+		for _, s := range d.Segments {
+			got = append(got, seg{s.Kind, s.Size, len(s.Data)})
+		}
+		if cut == len(input) {
+			if !reflect.DeepEqual(got, want) || d.Err != nil {
+				t.Errorf("segments = %v, error %v, want %v", got, d.Err, want)
+			}
+			continue
+		}
+		// the partial payload is limited as well.
+		if wantCut := []seg{{SegHeader, 4, 4}, {SegPayload, 496, 8}}; !reflect.DeepEqual(got, wantCut) {
+			t.Errorf("cut at %d: segments = %v, want %v", cut, got, wantCut)
+		}
+		if d.Err == nil || d.Err.Offset != int64(cut) {
+			t.Errorf("cut at %d: Dissection.Err = %v", cut, d.Err)
+		}
+	}
+}
+
+func TestDissection_Dump(t *testing.T) {
+	input := bytes.Join([][]byte{
+		sizeHintFrame(20),
+		must(newBinHeader(20, false)).Bytes(),
+		[]byte("0123456789abcdefghij"),
+		{0, 0, 0, 0x80, 'x'},
+	}, nil)
+	d, err := Dissect(bytes.NewReader(input), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := d.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"00000000  header    09 00 00 80                                     |....            |  frame 0: control, size 9, closed",
+		"00000004  payload   03 14 00 00 00 00 00 00 00                      |.........       |  size_hint size=20",
+		"0000000d  header    14 00 00 00                                     |....            |  frame 1: data, size 20",
+		"00000011  payload   30 31 32 33 34 35 36 37 38 39 61 62 63 64 65 66 |0123456789abcdef|  frame 1: 20 bytes",
+		"00000021  payload   ... 4 more bytes",
+		"00000025  header    00 00 00 80                                     |....            |  frame 2: closed, size 0",
+		"00000029  trailing  78                                              |x               |  1 bytes after the closed header",
+		"",
+	}, "\n")
+	if got := buf.String(); got != want {
+		t.Errorf("Dump() =\n%s\nwant\n%s", got, want)
+	}
+}
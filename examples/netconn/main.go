@@ -3,12 +3,12 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/rusq/conio"
 )
@@ -68,10 +68,6 @@ func main() {
 	}
 }
 
-type txinfo struct {
-	Size int64
-}
-
 type txresult struct {
 	OK   bool
 	Data []byte
@@ -80,24 +76,17 @@ type txresult struct {
 func send(conn net.Conn, r io.Reader, sz int64) error {
 	dumper := io.TeeReader(conn, os.Stderr)
 	enc, dec := json.NewEncoder(conn), json.NewDecoder(dumper)
-	// send size
-	if err := enc.Encode(txinfo{sz}); err != nil {
-		return err
-	}
 
-	// copy data
-	cw := conio.NewWriter(conn)
+	// copy data, the size is sent at the start of the stream
+	cw := conio.NewTransferWriter(conn, 5*time.Second, conio.WithSizeHint(sz))
 	if _, err := io.Copy(cw, r); err != nil {
 		return err
 	}
+	// close and wait for confirmation
 	if err := cw.Close(); err != nil {
-		panic(err)
-	}
-	res := txresult{}
-	// receive confirmation
-	if err := dec.Decode(&res); err != nil {
 		return err
 	}
+	res := txresult{}
 	// send something else
 	if err := enc.Encode(txresult{Data: []byte{19, 91, 9, 16}}); err != nil {
 		return err
@@ -112,25 +101,17 @@ func send(conn net.Conn, r io.Reader, sz int64) error {
 }
 
 func receive(w io.Writer, conn net.Conn) error {
-	dumper := io.TeeReader(conn, os.Stderr)
-	enc, dec := json.NewEncoder(conn), json.NewDecoder(dumper)
-	// receive info
-	ti := txinfo{}
-	if err := dec.Decode(&ti); err != nil {
-		return err
-	}
-	cr := conio.NewReader(conn)
-	// receive data
-	if n, err := io.Copy(w, cr); err != nil || n != ti.Size {
-		if err != nil {
-			return err
-		}
-		return fmt.Errorf("error:  received: %d,  expected:  %d", n, ti.Size)
-	}
-	// send result
-	if err := enc.Encode(txresult{OK: true}); err != nil {
+	cr := conio.NewTransferReader(conn)
+	// receive data, confirmation is sent automatically, and the short stream
+	// is reported as an error.
+	n, err := io.Copy(w, cr)
+	if err != nil {
 		return err
 	}
+	log.Printf("received %d of %d bytes", n, cr.ExpectedSize())
+
+	dumper := io.TeeReader(conn, os.Stderr)
+	enc, dec := json.NewEncoder(conn), json.NewDecoder(dumper)
 	res := txresult{}
 	// receive something else
 	if err := dec.Decode(&res); err != nil {
@@ -0,0 +1,168 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"runtime"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// fuzz option flags.
+const (
+	fzCompress = 1 << iota
+	fzChecksum
+	fzFrameSums
+	fzSizeHint
+	fzPrefetch
+	fzOneByte
+	fzMulti
+)
+
+// fuzzTimeout is the time the reader has to read the fuzz input.
+const fuzzTimeout = 10 * time.Second
+
+// fuzzAlloc returns the maximum number of bytes the reader may allocate while
+// reading the input of size n.  Deflate expands the data at most about 1032
+// times, and the workers and buffers add the constant overhead.
+func fuzzAlloc(n int) uint64 {
+	return 64<<20 + 2048*uint64(n)
+}
+
+// fuzzRead reads r until the error with ReadAll, and fails if it panics,
+// does not return in fuzzTimeout, or allocates more than limit bytes.
+func fuzzRead(t *testing.T, r io.Reader, limit uint64) ([]byte, error) {
+	t.Helper()
+	type result struct {
+		data []byte
+		err  error
+		pv   interface{}
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	resc := make(chan result, 1)
+	go func() {
+		var res result
+		defer func() {
+			res.pv = recover()
+			resc <- res
+		}()
+		res.data, res.err = io.ReadAll(r)
+	}()
+	var res result
+	select {
+	case res = <-resc:
+	case <-time.After(fuzzTimeout):
+		t.Fatalf("reader does not return in %s", fuzzTimeout)
+	}
+	if res.pv != nil {
+		t.Fatalf("reader panics: %v", res.pv)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > limit {
+		t.Fatalf("reader allocated %d bytes, want at most %d", n, limit)
+	}
+	return res.data, res.err
+}
+
+// fuzzReader returns the ConReader over p with the options selected by
+// flags.
+func fuzzReader(p []byte, flags uint8) *ConReader {
+	var src io.Reader = bytes.NewReader(p)
+	if flags&fzOneByte != 0 {
+		src = iotest.OneByteReader(src)
+	}
+	var opts []Option
+	if flags&fzPrefetch != 0 {
+		opts = append(opts, WithPrefetch(2, 0), WithConcurrency(2))
+	}
+	r := NewReader(src, opts...)
+	r.Multistream(flags&fzMulti != 0)
+	return r
+}
+
+// fuzzSeeds returns the valid streams for the seed corpus.
+func fuzzSeeds(f *testing.F) [][]byte {
+	var seeds [][]byte
+	for _, opts := range [][]Option{
+		nil,
+		{WithCompression(flate.BestSpeed)},
+		{WithChecksum(), WithFrameChecksum()},
+		{WithSizeHint(11)},
+	} {
+		var buf bytes.Buffer
+		writeStream(f, NewWriter(&buf, opts...), "hello", " world")
+		seeds = append(seeds, buf.Bytes())
+	}
+	return seeds
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add([]byte("hello, world"), []byte{5, 0, 7}, uint8(0))
+	f.Add([]byte("compressed compressed compressed"), []byte{10}, uint8(fzCompress|fzChecksum))
+	f.Add([]byte("hinted"), []byte{1, 1, 1, 1, 1, 1}, uint8(fzSizeHint|fzFrameSums|fzOneByte))
+	f.Add([]byte{}, []byte{}, uint8(fzPrefetch|fzMulti))
+	f.Fuzz(func(t *testing.T, data []byte, sizes []byte, flags uint8) {
+		var opts []Option
+		if flags&fzCompress != 0 {
+			opts = append(opts, WithCompression(flate.BestSpeed), WithConcurrency(2))
+		}
+		if flags&fzChecksum != 0 {
+			opts = append(opts, WithChecksum())
+		}
+		if flags&fzFrameSums != 0 {
+			opts = append(opts, WithFrameChecksum())
+		}
+		if flags&fzSizeHint != 0 {
+			opts = append(opts, WithSizeHint(int64(len(data))))
+		}
+		var buf bytes.Buffer
+		w := NewWriter(&buf, opts...)
+		// the sizes split the data into writes, the rest is written at once.
+		rest := data
+		for _, sz := range sizes {
+			n := min(int(sz), len(rest))
+			if _, err := w.Write(rest[:n]); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			rest = rest[n:]
+		}
+		if _, err := w.Write(rest); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+
+		r := fuzzReader(buf.Bytes(), flags)
+		defer r.Close()
+		got, err := fuzzRead(t, r, fuzzAlloc(buf.Len()+len(data)))
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("ReadAll() = %q, want %q", got, data)
+		}
+		// the multistream reader resets the stats looking for the next stream.
+		if flags&fzMulti == 0 && !r.Stats().Closed {
+			t.Fatal("Stats().Closed = false")
+		}
+	})
+}
+
+func FuzzConReader_Read(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed, uint8(0))
+		f.Add(seed, uint8(fzPrefetch|fzMulti))
+		f.Add(seed[:len(seed)/2], uint8(fzOneByte))
+	}
+	f.Add([]byte{0xff, 0xff, 0xff, 0x7f, 'x'}, uint8(fzPrefetch))
+	f.Fuzz(func(t *testing.T, data []byte, flags uint8) {
+		r := fuzzReader(data, flags)
+		defer r.Close()
+		// any result is fine, as long as the reader returns.
+		fuzzRead(t, r, fuzzAlloc(len(data)))
+	})
+}
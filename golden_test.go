@@ -0,0 +1,338 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden vectors in testdata/golden")
+
+// goldenDir is the directory of the golden vectors, see FORMAT.md.
+var goldenDir = filepath.Join("testdata", "golden")
+
+// goldenManifest is the description of the golden vectors for the other
+// implementations, stored in vectors.json.
+type goldenManifest struct {
+	Vectors []goldenVector `json:"vectors"`
+}
+
+// goldenVector describes the expected result of reading the vector file.
+type goldenVector struct {
+	Name        string         `json:"name"`
+	File        string         `json:"file"`
+	Description string         `json:"description"`
+	Streams     []goldenStream `json:"streams"`
+	// Error is the kind of the error, as returned by ErrorKind, that ends
+	// the last stream, or empty if it ends without an error.
+	Error string `json:"error,omitempty"`
+}
+
+// goldenStream is the expected result of reading one stream of the vector.
+type goldenStream struct {
+	Data     string `json:"data"`      // hex
+	SizeHint int64  `json:"size_hint"` // -1 if not declared
+	Closed   bool   `json:"closed"`    // the end of stream header is present
+}
+
+// goldenGen is the generator of the golden vector.
+type goldenGen struct {
+	vector goldenVector
+	gen    func(t *testing.T) []byte
+}
+
+func wantStream(data string, sizeHint int64, closed bool) goldenStream {
+	return goldenStream{Data: hex.EncodeToString([]byte(data)), SizeHint: sizeHint, Closed: closed}
+}
+
+var goldenVectors = []goldenGen{
+	{
+		goldenVector{
+			Name:        "empty",
+			Description: "The stream without data: the end of stream header only.",
+			Streams:     []goldenStream{wantStream("", -1, true)},
+		},
+		func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			writeStream(t, NewWriter(&buf))
+			return buf.Bytes()
+		},
+	},
+	{
+		goldenVector{
+			Name:        "single_frame",
+			Description: "One data frame.",
+			Streams:     []goldenStream{wantStream("hello", -1, true)},
+		},
+		func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			writeStream(t, NewWriter(&buf), "hello")
+			return buf.Bytes()
+		},
+	},
+	{
+		goldenVector{
+			Name:        "heartbeat",
+			Description: "Two data frames with the heartbeat between them, that carries no data.",
+			Streams:     []goldenStream{wantStream("hello world", -1, true)},
+		},
+		func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			io.WriteString(w, "hello")
+			buf.Write(must(newBinHeader(0, false)).Bytes())
+			io.WriteString(w, " world")
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			return buf.Bytes()
+		},
+	},
+	{
+		goldenVector{
+			Name:        "size_hint_checksum",
+			Description: "Control frames (closed flag with non-zero size): the size hint and the checksum announcement before the first data frame, and the trailer before the end of stream header.",
+			Streams:     []goldenStream{wantStream("hello world", 11, true)},
+		},
+		func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			writeStream(t, NewWriter(&buf, WithSizeHint(11), WithChecksum()), "hello", " world")
+			return buf.Bytes()
+		},
+	},
+	{
+		goldenVector{
+			Name:        "frame_checksum",
+			Description: "Each data frame followed by the control frame with the CRC-32 of its payload.",
+			Streams:     []goldenStream{wantStream("hello world", -1, true)},
+		},
+		func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			writeStream(t, NewWriter(&buf, WithFrameChecksum()), "hello", " world")
+			return buf.Bytes()
+		},
+	},
+	{
+		goldenVector{
+			Name:        "frame_checksum_mismatch",
+			Description: "The stream with the frame checksums, and the corrupted payload of the first data frame, that does not match its frame checksum.",
+			Streams:     []goldenStream{wantStream("jello", -1, false)},
+			Error:       "checksum",
+		},
+		func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			writeStream(t, NewWriter(&buf, WithFrameChecksum()), "hello", " world")
+			p := buf.Bytes()
+			p[bytes.Index(p, []byte("hello"))] = 'j'
+			return p
+		},
+	},
+	{
+		goldenVector{
+			Name:        "compressed",
+			Description: "The compression control frame, followed by the data frame compressed with raw deflate, using stored blocks.",
+			Streams:     []goldenStream{wantStream("hello hello hello", -1, true)},
+		},
+		func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			writeStream(t, NewWriter(&buf, WithCompression(flate.NoCompression), WithConcurrency(1)), "hello hello hello")
+			return buf.Bytes()
+		},
+	},
+	{
+		goldenVector{
+			Name:        "multiple_streams",
+			Description: "Two streams back to back, the first one with the checksum trailer.",
+			Streams:     []goldenStream{wantStream("first", -1, true), wantStream("second", -1, true)},
+		},
+		func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			writeStream(t, NewWriter(&buf, WithChecksum()), "first")
+			writeStream(t, NewWriter(&buf), "second")
+			return buf.Bytes()
+		},
+	},
+	{
+		goldenVector{
+			Name:        "max_size_header",
+			Description: "The data frame header with the maximum size (2^31-1), truncated after 3 bytes of payload.  The stream is incomplete, and the truncation must be reported.",
+			Streams:     []goldenStream{wantStream("max", -1, false)},
+			Error:       "unexpected_eof",
+		},
+		func(t *testing.T) []byte {
+			return append(must(newBinHeader(maxSz, false)).Bytes(), "max"...)
+		},
+	},
+	{
+		goldenVector{
+			Name:        "missing_closed_header",
+			Description: "The complete data frame, not followed by the end of stream header.  The stream is incomplete, and the truncation must be reported.",
+			Streams:     []goldenStream{wantStream("hello", -1, false)},
+			Error:       "unexpected_eof",
+		},
+		func(t *testing.T) []byte {
+			return append(must(newBinHeader(5, false)).Bytes(), "hello"...)
+		},
+	},
+	{
+		goldenVector{
+			Name:        "max_size_control",
+			Description: "The header with the closed flag and the maximum size, that is, the control frame larger than 65536 bytes, which is rejected.",
+			Streams:     []goldenStream{wantStream("", -1, false)},
+			Error:       "protocol",
+		},
+		func(t *testing.T) []byte {
+			return must(newBinHeader(maxSz, true)).Bytes()
+		},
+	},
+	{
+		goldenVector{
+			Name:        "unknown_control",
+			Description: "The control frame of the unknown kind 127, which is rejected.",
+			Streams:     []goldenStream{wantStream("", -1, false)},
+			Error:       "protocol",
+		},
+		func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			buf.Write(ctlFrame(0x7f, []byte{0}))
+			writeStream(t, NewWriter(&buf), "x")
+			return buf.Bytes()
+		},
+	},
+	{
+		goldenVector{
+			Name:        "checksum_mismatch",
+			Description: "The stream with the checksum trailer, and the corrupted data frame payload.",
+			Streams:     []goldenStream{wantStream("jello", -1, true)},
+			Error:       "checksum",
+		},
+		func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			writeStream(t, NewWriter(&buf, WithChecksum()), "hello")
+			p := buf.Bytes()
+			i := bytes.Index(p, []byte("hello"))
+			p[i] = 'j'
+			return p
+		},
+	},
+	{
+		goldenVector{
+			Name:        "short_stream",
+			Description: "The stream closed before the declared size of the data is transferred.",
+			Streams:     []goldenStream{wantStream("hello", 10, true)},
+			Error:       "short_stream",
+		},
+		func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			writeStream(t, NewWriter(&buf, WithSizeHint(10)), "hello")
+			return buf.Bytes()
+		},
+	},
+}
+
+// manifest returns the manifest of the golden vectors.
+func manifest() goldenManifest {
+	var m goldenManifest
+	for _, g := range goldenVectors {
+		v := g.vector
+		v.File = v.Name + ".bin"
+		m.Vectors = append(m.Vectors, v)
+	}
+	return m
+}
+
+// checkGolden compares data with the golden file name, or rewrites it, if
+// the -update flag is set.
+func checkGolden(t *testing.T, name string, data []byte) {
+	t.Helper()
+	path := filepath.Join(goldenDir, name)
+	if *update {
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("%s: generated\n%x\nwant\n%x", path, data, want)
+	}
+}
+
+func TestGolden_generate(t *testing.T) {
+	for _, g := range goldenVectors {
+		t.Run(g.vector.Name, func(t *testing.T) {
+			checkGolden(t, g.vector.Name+".bin", g.gen(t))
+		})
+	}
+	data, err := json.MarshalIndent(manifest(), "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "vectors.json", append(data, '\n'))
+}
+
+// readGolden reads the streams of p with ConReader, and returns the result
+// in the form of the manifest.
+func readGolden(p []byte) ([]goldenStream, string) {
+	r := NewReader(bytes.NewReader(p))
+	var streams []goldenStream
+	for {
+		data, err := ioutil.ReadAll(r)
+		streams = append(streams, goldenStream{
+			Data:     hex.EncodeToString(data),
+			SizeHint: r.ExpectedSize(),
+			Closed:   r.Stats().Closed,
+		})
+		if err != nil {
+			return streams, ErrorKind(err)
+		}
+		if err := r.Next(); err == io.EOF {
+			return streams, ""
+		} else if err != nil {
+			return streams, ErrorKind(err)
+		}
+	}
+}
+
+func TestGolden_parse(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join(goldenDir, "vectors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m goldenManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Vectors) == 0 {
+		t.Fatal("no vectors")
+	}
+	for _, v := range m.Vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			p, err := ioutil.ReadFile(filepath.Join(goldenDir, v.File))
+			if err != nil {
+				t.Fatal(err)
+			}
+			streams, errKind := readGolden(p)
+			if !reflect.DeepEqual(streams, v.Streams) {
+				t.Errorf("streams = %+v, want %+v", streams, v.Streams)
+			}
+			if errKind != v.Error {
+				t.Errorf("error = %q, want %q", errKind, v.Error)
+			}
+		})
+	}
+}
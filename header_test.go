@@ -6,6 +6,7 @@ import (
 	"io"
 	"reflect"
 	"testing"
+	"testing/iotest"
 )
 
 func Test_binheader_Bytes(t *testing.T) {
@@ -292,3 +293,61 @@ func Test_must(t *testing.T) {
 		})
 	}
 }
+
+func Fuzz_loadHeader(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0, 0})
+	f.Add([]byte{0, 0, 0, 0x80})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{5, 0, 0, 0x80, 1})
+	f.Fuzz(func(t *testing.T, p []byte) {
+		hdr, err := loadHeader(p)
+		if len(p) < hdrSz {
+			if err == nil {
+				t.Fatalf("loadHeader(%x) error = nil, want error", p)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("loadHeader(%x) error = %v", p, err)
+		}
+		if hdr.Size() < minSz || maxSz < hdr.Size() {
+			t.Fatalf("loadHeader(%x) size = %d, out of range", p, hdr.Size())
+		}
+		// the header must round-trip.
+		got, err := newBinHeader(hdr.Size(), hdr.IsClosed())
+		if err != nil {
+			t.Fatalf("newBinHeader(%d, %v) error = %v", hdr.Size(), hdr.IsClosed(), err)
+		}
+		if !bytes.Equal(got.Bytes(), p[:hdrSz]) {
+			t.Fatalf("header %x round-trips to %x", p[:hdrSz], got.Bytes())
+		}
+	})
+}
+
+func Fuzz_readHeader(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{1, 2})
+	f.Add([]byte{3, 0, 0, 0, 'a', 'b', 'c'})
+	f.Add([]byte{0, 0, 0, 0x80})
+	f.Fuzz(func(t *testing.T, p []byte) {
+		want, wantErr := loadHeader(p)
+		for _, r := range []io.Reader{bytes.NewReader(p), iotest.OneByteReader(bytes.NewReader(p))} {
+			got, err := readHeader(r)
+			switch {
+			case len(p) == 0:
+				if err != io.EOF {
+					t.Fatalf("readHeader(%x) error = %v, want io.EOF", p, err)
+				}
+			case len(p) < hdrSz:
+				if err != io.ErrUnexpectedEOF {
+					t.Fatalf("readHeader(%x) error = %v, want io.ErrUnexpectedEOF", p, err)
+				}
+			case err != nil || wantErr != nil:
+				t.Fatalf("readHeader(%x) error = %v, loadHeader error = %v", p, err, wantErr)
+			case !reflect.DeepEqual(got, want):
+				t.Fatalf("readHeader(%x) = %+v, loadHeader = %+v", p, got, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,342 @@
+package conio
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// The index footer follows the closed header of the stream, so that the
+// indexed file is still a valid stream for ConReader, which stops at the
+// closed header.  The footer consists of the index entries, one per data
+// frame, followed by the fixed size tail:
+//
+//	entry:  frame header offset (8 bytes), payload offset (8 bytes)
+//	tail:   entry count (8 bytes), payload size (8 bytes),
+//	        CRC-32 of the entries, count and size (4 bytes), magic (8 bytes)
+//
+// The payload offset is the offset of the frame data in the logical
+// payload, that is, in the concatenated data of all frames.  All integers
+// are little endian, as in the frame header.
+const (
+	idxEntrySz = 16
+	idxTailSz  = 8 + 8 + 4 + 8
+	idxMagic   = "CONIOIDX"
+)
+
+var (
+	// ErrCompressedIndex is returned by NewIndexReader if the stream is
+	// compressed, as the compressed streams can not be read at random.
+	ErrCompressedIndex = errors.New("random access to the compressed stream is not supported")
+	// errInvalidIndex is returned if the stream is not a valid indexed
+	// stream.
+	errInvalidIndex = errors.New("invalid index")
+)
+
+// idxEntry is the index entry of the data frame.
+type idxEntry struct {
+	frame   int64 // offset of the frame header in the stream
+	logical int64 // offset of the frame data in the logical payload
+}
+
+// IndexWriter writes the stream followed by the index footer, that allows
+// IndexReader to read the data at random.  It is intended for files.  The
+// stream is not compressed, WithCompression is ignored.
+type IndexWriter struct {
+	c  *ConWriter
+	cw *countWriter
+
+	entries []idxEntry // guarded by c.mu
+	size    int64      // logical payload size, guarded by c.mu
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewIndexWriter creates a new IndexWriter writing to w.
+func NewIndexWriter(w io.Writer, opts ...Option) *IndexWriter {
+	o := newOptions(opts)
+	o.compress = false
+	iw := &IndexWriter{cw: &countWriter{w: w}}
+	iw.c = &ConWriter{w: iw.cw, onFrame: iw.record}
+	iw.c.init(o)
+	return iw
+}
+
+// record records the index entry for the data frame of the given size,
+// that is about to be written.  It is called with c.mu held.
+func (w *IndexWriter) record(size int) {
+	w.entries = append(w.entries, idxEntry{frame: w.cw.n, logical: w.size})
+	w.size += int64(size)
+}
+
+// Write writes p as a frame of the stream.
+func (w *IndexWriter) Write(p []byte) (int, error) {
+	return w.c.Write(p)
+}
+
+// Flush waits until all data written to the asynchronous writer is written
+// to the underlying writer.  See ConWriter.Flush.
+func (w *IndexWriter) Flush() error {
+	return w.c.Flush()
+}
+
+// Stats returns the statistics of the frames written so far.
+func (w *IndexWriter) Stats() Stats {
+	return w.c.Stats()
+}
+
+// Close closes the stream, and writes the index footer.
+func (w *IndexWriter) Close() error {
+	if err := w.c.Close(); err != nil {
+		return err
+	}
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+	if _, err := w.cw.Write(indexFooter(w.entries, w.size)); err != nil {
+		return fmt.Errorf("error writing index: %w", err)
+	}
+	return nil
+}
+
+// indexFooter returns the serialised index footer.
+func indexFooter(entries []idxEntry, size int64) []byte {
+	buf := make([]byte, len(entries)*idxEntrySz+idxTailSz)
+	p := buf
+	for _, e := range entries {
+		endianness.PutUint64(p[0:], uint64(e.frame))
+		endianness.PutUint64(p[8:], uint64(e.logical))
+		p = p[idxEntrySz:]
+	}
+	endianness.PutUint64(p[0:], uint64(len(entries)))
+	endianness.PutUint64(p[8:], uint64(size))
+	endianness.PutUint32(p[16:], crc32.ChecksumIEEE(buf[:len(buf)-idxTailSz+16]))
+	copy(p[20:], idxMagic)
+	return buf
+}
+
+// IndexReader reads the logical payload of the stream at random.  If the
+// stream has the index footer written by IndexWriter, it is used to locate
+// the frames, otherwise the frame headers are scanned once, when the reader
+// is created.  The control frames, such as the size hint or the checksum
+// trailer, are not verified.  IndexReader implements io.Reader, io.ReaderAt
+// and io.Seeker.  ReadAt is safe for concurrent use, Read and Seek are not.
+type IndexReader struct {
+	r       io.ReaderAt
+	entries []idxEntry
+	size    int64 // logical payload size
+	indexed bool  // the index footer is used
+	off     int64 // current offset for Read and Seek
+}
+
+// NewIndexReader creates a new IndexReader reading the stream of size bytes
+// from r.  It returns ErrCompressedIndex if the stream is compressed.
+func NewIndexReader(r io.ReaderAt, size int64) (*IndexReader, error) {
+	ir := &IndexReader{r: r}
+	entries, total, err := loadIndex(r, size)
+	if err == nil {
+		ir.entries, ir.size, ir.indexed = entries, total, true
+		return ir, nil
+	}
+	if !errors.Is(err, errNoIndex) {
+		return nil, err
+	}
+	if ir.entries, ir.size, err = scanIndex(r, size); err != nil {
+		return nil, err
+	}
+	return ir, nil
+}
+
+// errNoIndex is returned by loadIndex if the stream has no index footer.
+var errNoIndex = errors.New("no index footer")
+
+// loadIndex loads the index footer from the end of the stream of size bytes.
+func loadIndex(r io.ReaderAt, size int64) ([]idxEntry, int64, error) {
+	if size < hdrSz+int64(idxTailSz) {
+		return nil, 0, errNoIndex
+	}
+	var tail [idxTailSz]byte
+	if _, err := r.ReadAt(tail[:], size-idxTailSz); err != nil {
+		return nil, 0, err
+	}
+	if string(tail[20:]) != idxMagic {
+		return nil, 0, errNoIndex
+	}
+	count := endianness.Uint64(tail[0:])
+	total := int64(endianness.Uint64(tail[8:]))
+	if count > uint64(size/idxEntrySz) {
+		return nil, 0, fmt.Errorf("%w: %d entries", errInvalidIndex, count)
+	}
+	start := size - idxTailSz - int64(count)*idxEntrySz
+	if start < hdrSz {
+		return nil, 0, fmt.Errorf("%w: %d entries", errInvalidIndex, count)
+	}
+	buf := make([]byte, int64(count)*idxEntrySz+16)
+	if _, err := r.ReadAt(buf, start); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(buf) != endianness.Uint32(tail[16:]) {
+		return nil, 0, fmt.Errorf("%w: checksum mismatch", errInvalidIndex)
+	}
+	if total < 0 || (count == 0 && total != 0) {
+		return nil, 0, fmt.Errorf("%w: payload size %d", errInvalidIndex, total)
+	}
+	entries := make([]idxEntry, count)
+	for i := range entries {
+		p := buf[i*idxEntrySz:]
+		entries[i] = idxEntry{
+			frame:   int64(endianness.Uint64(p[0:])),
+			logical: int64(endianness.Uint64(p[8:])),
+		}
+	}
+	// the CRC only detects the accidental corruption, so the entries are
+	// validated for the crafted footer not to make ReadAt fail:  the first
+	// frame starts at the start of the payload, and the frames follow each
+	// other, and end before the closed header that precedes the footer.
+	var end int64 // end of the previous frame
+	for i, e := range entries {
+		next := total // logical offset of the next frame
+		if i < len(entries)-1 {
+			next = entries[i+1].logical
+		}
+		if (i == 0 && e.logical != 0) || e.frame < end || e.logical < 0 ||
+			next < e.logical || next-e.logical > start {
+			return nil, 0, fmt.Errorf("%w: entry %d", errInvalidIndex, i)
+		}
+		end = e.frame + hdrSz + next - e.logical
+		if end > start-hdrSz {
+			return nil, 0, fmt.Errorf("%w: entry %d", errInvalidIndex, i)
+		}
+	}
+	return entries, total, nil
+}
+
+// scanIndex builds the index by scanning the frame headers of the stream of
+// size bytes.
+func scanIndex(r io.ReaderAt, size int64) ([]idxEntry, int64, error) {
+	var (
+		entries []idxEntry
+		total   int64
+		off     int64
+		buf     [hdrSz + 1]byte
+	)
+	for {
+		if off+hdrSz > size {
+			return nil, 0, fmt.Errorf("error scanning stream at offset %d: %w", off, io.ErrUnexpectedEOF)
+		}
+		if _, err := r.ReadAt(buf[:hdrSz], off); err != nil {
+			return nil, 0, fmt.Errorf("error scanning stream at offset %d: %w", off, err)
+		}
+		hdr := must(loadHeader(buf[:]))
+		switch frameType(hdr) {
+		case FrameClosed:
+			return entries, total, nil
+		case FrameControl:
+			if _, err := r.ReadAt(buf[hdrSz:], off+hdrSz); err != nil {
+				return nil, 0, fmt.Errorf("error scanning stream at offset %d: %w", off, err)
+			}
+			if buf[hdrSz] == ctlCompress {
+				return nil, 0, ErrCompressedIndex
+			}
+		case FrameData:
+			entries = append(entries, idxEntry{frame: off, logical: total})
+			total += int64(hdr.Size())
+		}
+		off += hdrSz + int64(hdr.Size())
+		if off > size {
+			return nil, 0, fmt.Errorf("error scanning stream at offset %d: %w", off, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+// Indexed returns true if the stream has the index footer.
+func (r *IndexReader) Indexed() bool {
+	return r.indexed
+}
+
+// Size returns the size of the logical payload.
+func (r *IndexReader) Size() int64 {
+	return r.size
+}
+
+// frameSize returns the data size of the i-th frame.
+func (r *IndexReader) frameSize(i int) int64 {
+	if i == len(r.entries)-1 {
+		return r.size - r.entries[i].logical
+	}
+	return r.entries[i+1].logical - r.entries[i].logical
+}
+
+// ReadAt implements io.ReaderAt over the logical payload.
+func (r *IndexReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("conio.IndexReader.ReadAt: negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	// the frame that contains off
+	i := sort.Search(len(r.entries), func(i int) bool { return r.entries[i].logical > off }) - 1
+	if i < 0 {
+		return 0, errInvalidIndex
+	}
+	var n int
+	for n < len(p) && i < len(r.entries) {
+		e := r.entries[i]
+		skip := off - e.logical
+		chunk := p[n:]
+		if rest := r.frameSize(i) - skip; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+		m, err := r.r.ReadAt(chunk, e.frame+hdrSz+skip)
+		n += m
+		off += int64(m)
+		if err != nil && !(err == io.EOF && m == len(chunk)) {
+			return n, unexpected(err)
+		}
+		i++
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read implements io.Reader.
+func (r *IndexReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.off)
+	r.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker over the logical payload.
+func (r *IndexReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("conio.IndexReader.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("conio.IndexReader.Seek: negative position")
+	}
+	r.off = offset
+	return offset, nil
+}
@@ -0,0 +1,164 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+// randomFrames splits data into frames of random size.
+func randomFrames(data []byte) []string {
+	var frames []string
+	rnd := rand.New(rand.NewSource(1))
+	for p := data; len(p) > 0; {
+		n := 1 + rnd.Intn(100)
+		if n > len(p) {
+			n = len(p)
+		}
+		frames = append(frames, string(p[:n]))
+		p = p[n:]
+	}
+	return frames
+}
+
+func TestIndexReader(t *testing.T) {
+	data := testText(5000)
+	tests := []struct {
+		name    string
+		indexed bool
+		opts    []Option
+	}{
+		{"indexed", true, nil},
+		{"indexed with controls", true, []Option{WithSizeHint(5000), WithChecksum()}},
+		{"indexed async", true, []Option{WithAsync(4)}},
+		{"scanned", false, []Option{WithSizeHint(5000), WithChecksum()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			var w io.WriteCloser = NewWriter(&buf, tt.opts...)
+			if tt.indexed {
+				w = NewIndexWriter(&buf, tt.opts...)
+			}
+			writeStream(t, w, randomFrames(data)...)
+			stream := buf.Bytes()
+			r, err := NewIndexReader(bytes.NewReader(stream), int64(len(stream)))
+			if err != nil {
+				t.Fatalf("NewIndexReader() error = %v", err)
+			}
+			if r.Indexed() != tt.indexed {
+				t.Errorf("IndexReader.Indexed() = %v, want %v", r.Indexed(), tt.indexed)
+			}
+			if r.Size() != int64(len(data)) {
+				t.Errorf("IndexReader.Size() = %d, want %d", r.Size(), len(data))
+			}
+			if err := iotest.TestReader(r, data); err != nil {
+				t.Error(err)
+			}
+			// the indexed stream is readable sequentially.
+			got, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream)))
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("ConReader.Read() error = %v, data match = %v", err, bytes.Equal(got, data))
+			}
+		})
+	}
+}
+
+func TestIndexReader_empty(t *testing.T) {
+	var buf bytes.Buffer
+	writeStream(t, NewIndexWriter(&buf))
+	stream := buf.Bytes()
+	r, err := NewIndexReader(bytes.NewReader(stream), int64(len(stream)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := iotest.TestReader(r, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewIndexReader_errors(t *testing.T) {
+	data := testText(1000)
+	var indexed, plain, compressed bytes.Buffer
+	writeStream(t, NewIndexWriter(&indexed), randomFrames(data)...)
+	writeStream(t, NewWriter(&plain), randomFrames(data)...)
+	writeStream(t, NewWriter(&compressed, WithCompression(flate.BestSpeed)), randomFrames(data)...)
+	corrupt := append([]byte(nil), indexed.Bytes()...)
+	corrupt[len(corrupt)-idxTailSz-1] ^= 0xff
+
+	tests := []struct {
+		name    string
+		stream  []byte
+		wantErr error
+	}{
+		{"compressed", compressed.Bytes(), ErrCompressedIndex},
+		{"corrupt index", corrupt, errInvalidIndex},
+		{"truncated", plain.Bytes()[:plain.Len()-10], io.ErrUnexpectedEOF},
+		{"no closed header", plain.Bytes()[:plain.Len()-hdrSz], io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewIndexReader(bytes.NewReader(tt.stream), int64(len(tt.stream)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewIndexReader() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestNewIndexReader_crafted checks that the footer with the valid CRC, but
+// the inconsistent entries, is rejected.
+func TestNewIndexReader_crafted(t *testing.T) {
+	var buf bytes.Buffer
+	writeStream(t, NewIndexWriter(&buf), randomFrames(testText(1000))...)
+	stream := buf.Bytes()
+	entries, total, err := loadIndex(bytes.NewReader(stream), int64(len(stream)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	footer := len(stream) - len(entries)*idxEntrySz - idxTailSz
+	tests := []struct {
+		name string
+		// craft modifies the copy of the entries, and returns the entries
+		// and the payload size of the footer.
+		craft func(e []idxEntry) ([]idxEntry, int64)
+	}{
+		{"first logical offset", func(e []idxEntry) ([]idxEntry, int64) { e[0].logical = 3; return e, total }},
+		{"frames out of order", func(e []idxEntry) ([]idxEntry, int64) {
+			e[0].frame, e[1].frame = e[1].frame, e[0].frame
+			return e, total
+		}},
+		{"overlapping frames", func(e []idxEntry) ([]idxEntry, int64) { e[1].frame--; return e, total }},
+		{"past closed header", func(e []idxEntry) ([]idxEntry, int64) { return e, total + 1 }},
+		{"size without entries", func(e []idxEntry) ([]idxEntry, int64) { return nil, total }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, size := tt.craft(append([]idxEntry(nil), entries...))
+			crafted := append(append([]byte(nil), stream[:footer]...), indexFooter(e, size)...)
+			if _, err := NewIndexReader(bytes.NewReader(crafted), int64(len(crafted))); !errors.Is(err, errInvalidIndex) {
+				t.Errorf("NewIndexReader() error = %v, want %v", err, errInvalidIndex)
+			}
+		})
+	}
+}
+
+func TestIndexWriter_compression(t *testing.T) {
+	// compression is ignored by the IndexWriter.
+	data := testText(1000)
+	var buf bytes.Buffer
+	writeStream(t, NewIndexWriter(&buf, WithCompression(flate.BestSpeed)), randomFrames(data)...)
+	stream := buf.Bytes()
+	r, err := NewIndexReader(bytes.NewReader(stream), int64(len(stream)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := iotest.TestReader(r, data); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,164 @@
+package conio
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"io"
+	"strconv"
+)
+
+// Metrics receives the stream events from ConReader and ConWriter.  It is
+// intended for process-wide instrumentation, so the same Metrics is usually
+// shared by many readers and writers, and implementations must be safe for
+// concurrent use.
+type Metrics interface {
+	// StreamOpened is called on the first Read of ConReader, and on the
+	// first Write or Close of ConWriter.
+	StreamOpened(dir Direction)
+	// StreamClosed is called when the closed header is received or sent.
+	StreamClosed(dir Direction)
+	// Frame is called for each data frame received or sent, with the size
+	// of its payload.
+	Frame(dir Direction, size int)
+	// Error is called when Read, Write or Close returns an error, other than
+	// io.EOF.
+	Error(dir Direction, err error)
+}
+
+// WithMetrics sets the metrics hook m.
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// ErrorKind returns the short name of the kind of the error, suitable for a
+// metric label:  "short_stream", "too_long", "ack_mismatch", "checksum",
+// "protocol", "unexpected_eof", "closed", "timeout", "canceled", or "io" for
+// all other errors.
+func ErrorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrShortStream):
+		return "short_stream"
+	case errors.Is(err, ErrStreamTooLong):
+		return "too_long"
+	case errors.Is(err, ErrAckMismatch):
+		return "ack_mismatch"
+	case errors.Is(err, ErrChecksum):
+		return "checksum"
+	case errors.Is(err, errUnknownControl),
+		errors.Is(err, errInvalidControl),
+		errors.Is(err, errInvalidAck),
+		errors.Is(err, errBlockSize):
+		return "protocol"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "unexpected_eof"
+	case errors.Is(err, ErrClosed), errors.Is(err, errReaderClosed):
+		return "closed"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	return "io"
+}
+
+// frameBuckets are the upper bounds of the frame size histogram buckets.
+var frameBuckets = []int{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20}
+
+// ExpvarMetrics is the Metrics that publishes the counters with expvar.
+// For each direction ("read" and "write"), it maintains the following
+// variables in the published map:
+//
+//	<dir>.streams_opened  number of streams opened
+//	<dir>.streams_closed  number of streams closed
+//	<dir>.frames          number of data frames
+//	<dir>.bytes           size of the data frame payloads
+//	<dir>.errors          map of the error counts by ErrorKind
+//	<dir>.frame_size      map of the frame counts by the size bucket
+//
+// The frame size bucket is the smallest of 64, 256, 1024, ... 4194304 that
+// is not less than the frame size, or "inf".  The counts are not
+// cumulative.
+type ExpvarMetrics struct {
+	root expvar.Map
+	dirs [2]expvarDir
+}
+
+type expvarDir struct {
+	opened, closed, frames, bytes expvar.Int
+	errors, sizes                 expvar.Map
+}
+
+var _ Metrics = (*ExpvarMetrics)(nil)
+
+// NewExpvarMetrics creates the ExpvarMetrics and publishes its map with the
+// given name.  As expvar.Publish, it panics if the name is already
+// registered.  It is NewUnpublishedExpvarMetrics followed by Publish.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	m := NewUnpublishedExpvarMetrics()
+	m.Publish(name)
+	return m
+}
+
+// NewUnpublishedExpvarMetrics creates the ExpvarMetrics without publishing
+// its map.  Use Publish to publish it, or add Map to another map.
+func NewUnpublishedExpvarMetrics() *ExpvarMetrics {
+	m := new(ExpvarMetrics)
+	m.root.Init()
+	for i, dir := range []string{"read", "write"} {
+		d := &m.dirs[i]
+		d.errors.Init()
+		d.sizes.Init()
+		m.root.Set(dir+".streams_opened", &d.opened)
+		m.root.Set(dir+".streams_closed", &d.closed)
+		m.root.Set(dir+".frames", &d.frames)
+		m.root.Set(dir+".bytes", &d.bytes)
+		m.root.Set(dir+".errors", &d.errors)
+		m.root.Set(dir+".frame_size", &d.sizes)
+	}
+	return m
+}
+
+// Publish publishes the map of m with the given name.  As expvar.Publish,
+// it panics if the name is already registered.
+func (m *ExpvarMetrics) Publish(name string) {
+	expvar.Publish(name, &m.root)
+}
+
+// Map returns the map of the variables of m.
+func (m *ExpvarMetrics) Map() *expvar.Map {
+	return &m.root
+}
+
+func (m *ExpvarMetrics) dir(dir Direction) *expvarDir {
+	if dir == DirWrite {
+		return &m.dirs[1]
+	}
+	return &m.dirs[0]
+}
+
+func (m *ExpvarMetrics) StreamOpened(dir Direction) { m.dir(dir).opened.Add(1) }
+func (m *ExpvarMetrics) StreamClosed(dir Direction) { m.dir(dir).closed.Add(1) }
+
+func (m *ExpvarMetrics) Frame(dir Direction, size int) {
+	d := m.dir(dir)
+	d.frames.Add(1)
+	d.bytes.Add(int64(size))
+	d.sizes.Add(frameBucket(size), 1)
+}
+
+func (m *ExpvarMetrics) Error(dir Direction, err error) {
+	m.dir(dir).errors.Add(ErrorKind(err), 1)
+}
+
+// frameBucket returns the histogram bucket name for the frame size.
+func frameBucket(size int) string {
+	for _, b := range frameBuckets {
+		if size <= b {
+			return strconv.Itoa(b)
+		}
+	}
+	return "inf"
+}
@@ -0,0 +1,138 @@
+package conio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// recMetrics records the metrics events.
+type recMetrics struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (m *recMetrics) add(format string, a ...interface{}) {
+	m.mu.Lock()
+	m.events = append(m.events, fmt.Sprintf(format, a...))
+	m.mu.Unlock()
+}
+
+func (m *recMetrics) StreamOpened(dir Direction)     { m.add("open %d", dir) }
+func (m *recMetrics) StreamClosed(dir Direction)     { m.add("close %d", dir) }
+func (m *recMetrics) Frame(dir Direction, size int)  { m.add("frame %d %d", dir, size) }
+func (m *recMetrics) Error(dir Direction, err error) { m.add("error %d %s", dir, ErrorKind(err)) }
+
+func TestWithMetrics(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		wm  recMetrics
+		rm  recMetrics
+	)
+	w := NewWriter(&buf, WithMetrics(&wm))
+	w.Write([]byte{1, 2, 3})
+	w.Write([]byte{4, 5, 6, 7, 8})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte{9}); err == nil {
+		t.Fatal("expected an error")
+	}
+	wantW := []string{"open 2", "frame 2 3", "frame 2 5", "close 2", "error 2 closed"}
+	if !reflect.DeepEqual(wm.events, wantW) {
+		t.Errorf("writer events = %q, want %q", wm.events, wantW)
+	}
+
+	r := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-2]), WithMetrics(&rm))
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Fatal("expected an error")
+	}
+	wantR := []string{"open 1", "frame 1 3", "frame 1 5", "error 1 unexpected_eof"}
+	if !reflect.DeepEqual(rm.events, wantR) {
+		t.Errorf("reader events = %q, want %q", rm.events, wantR)
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{ErrShortStream, "short_stream"},
+		{fmt.Errorf("wrapped: %w", ErrStreamTooLong), "too_long"},
+		{ErrAckMismatch, "ack_mismatch"},
+		{errUnknownControl, "protocol"},
+		{io.ErrUnexpectedEOF, "unexpected_eof"},
+		{ErrClosed, "closed"},
+		{context.DeadlineExceeded, "timeout"},
+		{context.Canceled, "canceled"},
+		{errors.New("connection reset"), "io"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := ErrorKind(tt.err); got != tt.want {
+				t.Errorf("ErrorKind() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	m := NewUnpublishedExpvarMetrics()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithMetrics(m))
+	w.Write(make([]byte, 64))
+	w.Write(make([]byte, 65))
+	w.Write(make([]byte, 5<<20))
+	w.Close()
+	w.Close()
+
+	root := m.Map()
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"write.streams_opened", "1"},
+		{"write.streams_closed", "1"},
+		{"write.frames", "3"},
+		{"write.bytes", fmt.Sprint(129 + 5<<20)},
+		{"write.errors", `{"closed": 1}`},
+		{"write.frame_size", `{"256": 1, "64": 1, "inf": 1}`},
+		{"read.frames", "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := root.Get(tt.key).String(); got != tt.want {
+				t.Errorf("%s = %s, want %s", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+// expvarSeq makes the expvar names unique across the test runs in the same
+// process, as the names can not be unregistered.
+var expvarSeq atomic.Int64
+
+func TestExpvarMetrics_Publish(t *testing.T) {
+	name := fmt.Sprintf("conio_test_%d", expvarSeq.Add(1))
+	m := NewExpvarMetrics(name)
+	m.StreamOpened(DirRead)
+	root, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		t.Fatalf("expvar.Get(%q) = %T, want *expvar.Map", name, expvar.Get(name))
+	}
+	if got := root.Get("read.streams_opened").String(); got != "1" {
+		t.Errorf("read.streams_opened = %s, want 1", got)
+	}
+	// the unpublished metrics do not register the names.
+	NewUnpublishedExpvarMetrics()
+	NewUnpublishedExpvarMetrics()
+}
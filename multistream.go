@@ -0,0 +1,105 @@
+package conio
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// Multistream controls whether the reader supports the multistream input,
+// as gzip.Reader.Multistream does.  If enabled, the default being disabled,
+// the reader expects the input to be a sequence of streams, each ending
+// with the closed header, and reads them as one, returning io.EOF only at
+// the end of the underlying reader.  Each stream is verified and
+// acknowledged separately, as if read with Next.  It must not be enabled
+// if the data other than conio streams follows the stream, or if the
+// underlying reader does not end, like the network connection that stays
+// open, as the reader would block waiting for the next stream.
+func (r *ConReader) Multistream(ok bool) {
+	r.multi = ok
+}
+
+// Next advances the reader to the next stream of the multistream input,
+// skipping the unread data of the current stream, if any.  It returns
+// io.EOF if there are no more streams.  The reader state, such as the
+// statistics, the expected size and the compression, applies to the
+// current stream.  Next blocks until the header of the next stream is
+// received.  Seeking with Seek is limited to the current stream.
+//
+//	for {
+//		if _, err := io.Copy(w, r); err != nil {
+//			return err
+//		}
+//		if err := r.Next(); err == io.EOF {
+//			break
+//		} else if err != nil {
+//			return err
+//		}
+//	}
+func (r *ConReader) Next() error {
+	if !r.eof {
+		if _, err := io.Copy(ioutil.Discard, streamReader{r}); err != nil {
+			return err
+		}
+	}
+	r.reset()
+	hdr, err := r.header()
+	if err != nil {
+		r.eof = true
+		return err
+	}
+	r.peeked = hdr
+	return nil
+}
+
+// streamReader reads the current stream of the ConReader.
+type streamReader struct {
+	r *ConReader
+}
+
+func (s streamReader) Read(p []byte) (int, error) {
+	return s.r.readStream(p)
+}
+
+// reset resets the reader state for the next stream.
+func (r *ConReader) reset() {
+	if r.ra != nil {
+		r.ra.close()
+		r.ra = nil
+	}
+	r.unread, r.eof = 0, false
+	r.nhdr, r.ctl, r.part = 0, nil, nil
+	r.codec, r.cur, r.pending, r.err = nil, nil, nil, nil
+	r.n, r.frame = 0, 0
+	if r.crc != nil {
+		r.crc.Reset()
+	}
+	r.summed, r.trailer = false, nil
+	r.summable = false
+	r.setExpectedSize(-1)
+	r.stats.reset()
+	r.opened = false
+
+	r.base += r.wire
+	r.wire = 0
+	r.frames, r.ended, r.seeked = nil, false, false
+}
+
+// header returns the header read by Next, or reads the next header.  If
+// the read fails, the bytes read so far are kept, and the next call
+// continues, so that the read interrupted by the deadline can be retried.
+func (r *ConReader) header() (*binheader, error) {
+	if hdr := r.peeked; hdr != nil {
+		r.peeked = nil
+		return hdr, nil
+	}
+	n, err := io.ReadFull(r.r, r.hdr[r.nhdr:])
+	r.nhdr += n
+	if err != nil {
+		if err == io.EOF && r.nhdr > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	r.nhdr = 0
+	return loadHeader(r.hdr[:])
+}
@@ -0,0 +1,109 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestConReader_Next(t *testing.T) {
+	data := []string{"first", "second stream", "", "fourth"}
+	var buf bytes.Buffer
+	writeStream(t, NewWriter(&buf, WithSizeHint(5)), data[0])
+	writeStream(t, NewWriter(&buf, WithCompression(flate.BestSpeed), WithChecksum()), data[1])
+	writeStream(t, NewWriter(&buf), data[2])
+	writeStream(t, NewWriter(&buf, WithChecksum()), data[3])
+	input := buf.Bytes()
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"prefetch", []Option{WithPrefetch(2, 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(bytes.NewReader(input), tt.opts...)
+			defer r.Close()
+			var got []string
+			for {
+				p, err := ioutil.ReadAll(r)
+				if err != nil {
+					t.Fatalf("stream %d: ConReader.Read() error = %v", len(got), err)
+				}
+				got = append(got, string(p))
+				if !r.Stats().Closed {
+					t.Errorf("stream %d: Stats().Closed = false", len(got))
+				}
+				if err := r.Next(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("ConReader.Next() error = %v", err)
+				}
+				if got := r.ExpectedSize(); got != -1 {
+					t.Errorf("ExpectedSize() after Next = %d, want -1", got)
+				}
+			}
+			if !reflect.DeepEqual(got, data) {
+				t.Errorf("streams = %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestConReader_NextSkip(t *testing.T) {
+	var buf bytes.Buffer
+	writeStream(t, NewWriter(&buf, WithChecksum()), "first")
+	writeStream(t, NewWriter(&buf), "second")
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	// read the part of the first stream only.
+	if _, err := r.Read(make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Next(); err != nil {
+		t.Fatalf("ConReader.Next() error = %v", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || string(got) != "second" {
+		t.Errorf("ConReader.Read() = %q, %v, want %q", got, err, "second")
+	}
+	if err := r.Next(); err != io.EOF {
+		t.Errorf("ConReader.Next() error = %v, want io.EOF", err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("ConReader.Read() after the last stream = %d, %v", n, err)
+	}
+}
+
+func TestConReader_Multistream(t *testing.T) {
+	var buf bytes.Buffer
+	writeStream(t, NewWriter(&buf), "one ")
+	writeStream(t, NewWriter(&buf, WithCompression(flate.BestSpeed)), "two ")
+	writeStream(t, NewWriter(&buf, WithChecksum()), "three")
+	input := buf.Bytes()
+	tests := []struct {
+		name  string
+		multi bool
+		want  string
+	}{
+		{"enabled", true, "one two three"},
+		{"disabled", false, "one "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(bytes.NewReader(input))
+			defer r.Close()
+			r.Multistream(tt.multi)
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ConReader.Read() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ConReader.Read() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package conio
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// Option is the function that configures ConReader or ConWriter.  Options
+// that do not apply to the reader or writer being created are ignored.
+type Option func(*options)
+
+type options struct {
+	keepalive time.Duration // writer heartbeat interval
+	async     int           // writer queue depth
+	compress  bool          // writer compresses data frames
+	level     int           // writer compression level
+	nworkers  int           // number of compression workers
+
+	prefetch      int // reader read-ahead depth, in frames
+	prefetchLimit int // reader read-ahead memory limit, in bytes
+
+	progress func(Progress) // progress callback
+
+	rate  int             // rate limit, bytes per second
+	burst int             // rate limit burst, bytes
+	clock Clock           // rate limiter clock
+	ctx   context.Context // rate limiter context
+
+	hinted    bool  // size hint is set
+	sizeHint  int64 // declared size of the stream data
+	checksum  bool  // writer sends the checksum trailer
+	frameSums bool  // writer sends the checksum of each data frame
+
+	deadline time.Time // transfer writer read deadline to restore
+
+	metrics Metrics      // metrics hook
+	logger  *slog.Logger // frame logger
+
+	fragment int           // pipe chunk size
+	latency  time.Duration // pipe delivery delay
+}
+
+// WithKeepalive makes the ConWriter send a heartbeat frame if nothing has
+// been written for the interval d.  Heartbeats carry no data, and are
+// skipped by ConReader.  It is useful to prevent idle connections from being
+// terminated by middleboxes.  Zero or negative d disables heartbeats.
+// Applies to ConWriter only.
+func WithKeepalive(d time.Duration) Option {
+	return func(o *options) {
+		o.keepalive = d
+	}
+}
+
+// WithAsync makes the ConWriter asynchronous.  Write copies the data into a
+// buffer and hands it to the background goroutine through the queue of depth
+// frames, blocking only if the queue is full.  Use Flush to wait for the
+// queued frames to be written.  Zero or negative depth disables asynchronous
+// mode.  Applies to ConWriter only.
+func WithAsync(depth int) Option {
+	return func(o *options) {
+		o.async = depth
+	}
+}
+
+// WithCompression makes the ConWriter compress the data with deflate at the
+// given level (see compress/flate).  The data is packed into blocks, and each
+// block is compressed independently into a single frame, which allows
+// compressing and decompressing blocks in parallel (see WithConcurrency).  The
+// incomplete block is written on Flush or Close.  Invalid level is replaced
+// with flate.DefaultCompression.  ConReader detects the compressed stream
+// automatically.  WithCompression overrides WithAsync, as the compressing
+// writer is asynchronous.  Applies to ConWriter only.
+func WithCompression(level int) Option {
+	return func(o *options) {
+		o.compress = true
+		o.level = level
+	}
+}
+
+// WithConcurrency sets the number of workers that compress or decompress the
+// frames.  Zero or negative n means runtime.GOMAXPROCS(0) workers.
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.nworkers = n
+	}
+}
+
+// WithPrefetch makes the ConReader read up to frames frames ahead in
+// background, so that the network receive overlaps with the processing of
+// the data by the caller.  The total size of the frame payloads read ahead is
+// bounded by limit bytes, but at least one frame is always read ahead, even
+// if it is larger than limit.  Zero limit means no limit.  Zero or negative
+// frames disables prefetching.  The prefetching reader reads the stream up
+// to the closed header independently of the caller, and must be closed if
+// abandoned before the end of the stream.  Applies to ConReader only.
+func WithPrefetch(frames int, limit int) Option {
+	return func(o *options) {
+		o.prefetch = frames
+		o.prefetchLimit = limit
+	}
+}
+
+// Progress is the progress of the transfer.
+type Progress struct {
+	// Frame is the size of the data in the current frame.  For the
+	// compressed stream, it is the size of the decompressed data.
+	Frame int
+	// Bytes is the cumulative number of data bytes transferred.
+	Bytes int64
+	// Total is the total number of data bytes expected, if declared with
+	// WithSizeHint, or zero if unknown.
+	Total int64
+}
+
+// WithProgress sets the progress callback fn.  ConWriter calls it after each
+// frame is written, and ConReader calls it after each Read that returns
+// data.  For the asynchronous or compressing writer, fn is called from the
+// background goroutine.  fn must not call the methods of the reader or
+// writer, and should return quickly, as it blocks the transfer.
+func WithProgress(fn func(Progress)) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+// WithRateLimit limits the throughput of ConWriter or ConReader to rate bytes
+// per second, with bursts of up to burst bytes.  If burst is zero or
+// negative, it is equal to rate.  The limit applies to the frames, including
+// headers:  ConWriter waits before writing the frame, and ConReader waits
+// before returning the data of the frame that has been received.  Frames
+// larger than burst are allowed, but delay the subsequent frames.  Zero or
+// negative rate disables the limit.
+func WithRateLimit(rate, burst int) Option {
+	return func(o *options) {
+		o.rate = rate
+		o.burst = burst
+	}
+}
+
+// WithClock sets the clock used by the rate limiter.  It is mostly useful for
+// testing.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithContext sets the context for the rate limiter waits.  Once ctx is done,
+// the waiting Read or Write returns the context error.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithSizeHint declares the total size of the data n that will be written
+// to the ConWriter.  The size hint is sent at the start of the stream, and
+// ConReader exposes it with ExpectedSize.  Both the writer and the reader
+// return ErrStreamTooLong if the stream exceeds n, and ErrShortStream if the
+// stream is closed before n bytes are transferred.  ConWriter.Close closes
+// the stream even if it returns ErrShortStream.  Negative n is ignored.
+// Applies to ConWriter only.
+func WithSizeHint(n int64) Option {
+	return func(o *options) {
+		o.hinted = n >= 0
+		o.sizeHint = n
+	}
+}
+
+// WithChecksum makes the ConWriter send the trailer with the number of bytes
+// written and their CRC-32 (IEEE) at the end of the stream.  ConReader
+// verifies the data received against the trailer, and returns ErrChecksum
+// instead of io.EOF if it does not match.  Applies to ConWriter only.
+func WithChecksum() Option {
+	return func(o *options) {
+		o.checksum = true
+	}
+}
+
+// WithFrameChecksum makes the ConWriter follow each data frame with the
+// control frame carrying the CRC-32 (IEEE) of its payload, as written, that
+// is, compressed, if the stream is compressed.  ConReader verifies each
+// frame against its checksum, and returns ErrChecksum on mismatch.  The
+// frame checksums also allow RecoveryReader to verify the frames of the
+// damaged stream, and to find the intact frames after the corrupted region.
+// Applies to ConWriter only.
+func WithFrameChecksum() Option {
+	return func(o *options) {
+		o.frameSums = true
+	}
+}
+
+// WithReadDeadline tells the writer created with NewTransferWriter the read
+// deadline t the caller has set on the connection, as it can not be queried
+// from the connection.  If the wait for the acknowledgement is interrupted
+// (see ConWriter.CloseContext), the read deadline of the connection is
+// restored to t.  By default, it is restored to zero, that is, no deadline.
+// Applies to NewTransferWriter only.
+func WithReadDeadline(t time.Time) Option {
+	return func(o *options) {
+		o.deadline = t
+	}
+}
+
+// WithFragmentation makes the Pipe deliver the data in chunks of at most n
+// bytes, so that the reader receives the frames in pieces, as it would from
+// the network.  Zero or negative n disables fragmentation.  Applies to Pipe
+// only.
+func WithFragmentation(n int) Option {
+	return func(o *options) {
+		o.fragment = n
+	}
+}
+
+// WithLatency makes the Pipe deliver the data written to it after the delay
+// d.  The writer is not delayed, unless the pipe buffer is full.  The clock
+// set with WithClock is used for the delays.  Applies to Pipe only.
+func WithLatency(d time.Duration) Option {
+	return func(o *options) {
+		o.latency = d
+	}
+}
+
+// limiter returns the rate limiter, or nil, if the rate is not limited.
+func (o options) limiter() *limiter {
+	if o.rate <= 0 {
+		return nil
+	}
+	return newLimiter(o.rate, o.burst, o.clock)
+}
+
+// context returns the context for the rate limiter.
+func (o options) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+// workers returns the number of compression workers.
+func (o options) workers() int {
+	if o.nworkers <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return o.nworkers
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,201 @@
+package conio
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// pipeBufSz is the amount of data the pipe buffers before Write blocks.
+const pipeBufSz = 64 << 10
+
+// Pipe creates a connected in-memory ConReader and ConWriter pair.  The data
+// written to the ConWriter is framed as usual, passed through the in-memory
+// buffer, and read by the ConReader, so that the pair behaves as the reader
+// and writer at the two ends of the connection.  It is useful for testing,
+// and for connecting the goroutines of the pipeline in-process.
+//
+// The options are applied to both the reader and the writer.
+// WithFragmentation splits the transfer into small chunks, and WithLatency
+// delays their delivery, to simulate the network.
+//
+// Closing the ConWriter closes the write end of the pipe once the stream is
+// closed, and the reader gets io.EOF after the end of the stream.  Closing the
+// ConReader closes the read end, and the pending and subsequent writes fail
+// with io.ErrClosedPipe.
+func Pipe(opts ...Option) (*ConReader, *ConWriter) {
+	o := newOptions(opts)
+	p := newPipe(o.fragment, o.latency, o.clock)
+
+	cw := &ConWriter{w: p}
+	cw.init(o)
+	cw.closer = pipeWriter{p}
+	cr := &ConReader{r: p}
+	cr.init(o)
+	cr.closer = pipeReader{p}
+	return cr, cw
+}
+
+// pipe is the in-memory transport of Pipe.  It is safe for one reader and one
+// writer goroutine.
+type pipe struct {
+	chunk   int           // maximum chunk size, 0 means no limit
+	latency time.Duration // delay of each chunk
+	clock   Clock
+
+	mu       sync.Mutex
+	chunks   []pipeChunk // written, but not read yet
+	buffered int         // size of chunks
+	wclosed  bool        // write end is closed
+	rclosed  bool        // read end is closed
+
+	readable chan struct{} // signalled when chunks are added, or write end closed
+	writable chan struct{} // signalled when chunks are consumed
+	done     chan struct{} // closed when the read end is closed
+}
+
+// pipeChunk is the chunk of the data written to the pipe.
+type pipeChunk struct {
+	data []byte
+	at   time.Time // time of delivery
+}
+
+func newPipe(chunk int, latency time.Duration, clock Clock) *pipe {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	if chunk < 0 {
+		chunk = 0
+	}
+	return &pipe{
+		chunk:    chunk,
+		latency:  latency,
+		clock:    clock,
+		readable: make(chan struct{}, 1),
+		writable: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// signal wakes up the goroutine waiting on ch, if any.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Write copies b into the pipe, splitting it into chunks.  It blocks while
+// the pipe buffer is full.
+func (p *pipe) Write(b []byte) (int, error) {
+	var n int
+	for len(b) > 0 {
+		p.mu.Lock()
+		if p.rclosed || p.wclosed {
+			p.mu.Unlock()
+			return n, io.ErrClosedPipe
+		}
+		space := pipeBufSz - p.buffered
+		if space <= 0 {
+			p.mu.Unlock()
+			select {
+			case <-p.writable:
+			case <-p.done:
+			}
+			continue
+		}
+		at := p.clock.Now().Add(p.latency)
+		for len(b) > 0 && space > 0 {
+			sz := len(b)
+			if sz > space {
+				sz = space
+			}
+			if p.chunk > 0 && sz > p.chunk {
+				sz = p.chunk
+			}
+			p.chunks = append(p.chunks, pipeChunk{data: append([]byte(nil), b[:sz]...), at: at})
+			p.buffered += sz
+			space -= sz
+			n += sz
+			b = b[sz:]
+		}
+		p.mu.Unlock()
+		signal(p.readable)
+	}
+	return n, nil
+}
+
+// Read reads the data from the first chunk, once it is delivered.  It returns
+// at most one chunk, so that the reader sees the fragmentation.
+func (p *pipe) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	for {
+		p.mu.Lock()
+		if p.rclosed {
+			p.mu.Unlock()
+			return 0, io.ErrClosedPipe
+		}
+		if len(p.chunks) > 0 {
+			c := &p.chunks[0]
+			if wait := c.at.Sub(p.clock.Now()); wait > 0 {
+				p.mu.Unlock()
+				select {
+				case <-p.clock.After(wait):
+				case <-p.done:
+				}
+				continue
+			}
+			n := copy(b, c.data)
+			c.data = c.data[n:]
+			if len(c.data) == 0 {
+				p.chunks[0] = pipeChunk{}
+				p.chunks = p.chunks[1:]
+			}
+			p.buffered -= n
+			p.mu.Unlock()
+			signal(p.writable)
+			return n, nil
+		}
+		if p.wclosed {
+			p.mu.Unlock()
+			return 0, io.EOF
+		}
+		p.mu.Unlock()
+		select {
+		case <-p.readable:
+		case <-p.done:
+		}
+	}
+}
+
+// closeWrite closes the write end.  The reader gets io.EOF once the buffered
+// data is read.
+func (p *pipe) closeWrite() {
+	p.mu.Lock()
+	p.wclosed = true
+	p.mu.Unlock()
+	signal(p.readable)
+}
+
+// closeRead closes the read end, discarding the buffered data.
+func (p *pipe) closeRead() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rclosed {
+		return
+	}
+	p.rclosed = true
+	p.chunks, p.buffered = nil, 0
+	close(p.done)
+}
+
+// pipeWriter and pipeReader close the respective ends of the pipe.
+type (
+	pipeWriter struct{ p *pipe }
+	pipeReader struct{ p *pipe }
+)
+
+func (w pipeWriter) Close() error { w.p.closeWrite(); return nil }
+func (r pipeReader) Close() error { r.p.closeRead(); return nil }
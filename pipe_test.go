@@ -0,0 +1,149 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+	data := bytes.Repeat([]byte("pipe data 0123456789"), 5000)
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"fragmented", []Option{WithFragmentation(3)}},
+		{"latency", []Option{WithLatency(time.Millisecond), WithClock(newFakeClock())}},
+		{"compressed", []Option{WithCompression(flate.BestSpeed), WithFragmentation(7)}},
+		{"checksum", []Option{WithChecksum(), WithSizeHint(int64(len(data))), WithPrefetch(2, 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w := Pipe(tt.opts...)
+			defer r.Close()
+			errc := make(chan error, 1)
+			go func() {
+				for p := data; len(p) > 0; {
+					n := 1000
+					if n > len(p) {
+						n = len(p)
+					}
+					if _, err := w.Write(p[:n]); err != nil {
+						errc <- err
+						return
+					}
+					p = p[n:]
+				}
+				errc <- w.Close()
+			}()
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if err := <-errc; err != nil {
+				t.Fatalf("writer error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("data mismatch: got %d bytes, want %d", len(got), len(data))
+			}
+			if !r.Stats().Closed {
+				t.Error("Stats().Closed = false")
+			}
+		})
+	}
+}
+
+func TestPipe_fragmentation(t *testing.T) {
+	r, w := Pipe(WithFragmentation(2))
+	defer r.Close()
+	go func() {
+		w.Write([]byte("hello"))
+		w.Close()
+	}()
+	// the underlying reads must not exceed the chunk size.
+	p := make([]byte, 16)
+	for {
+		n, err := r.r.Read(p)
+		if n > 2 {
+			t.Errorf("pipe Read() = %d bytes, want at most 2", n)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPipe_latency(t *testing.T) {
+	clock := newFakeClock()
+	r, w := Pipe(WithLatency(50*time.Millisecond), WithClock(clock))
+	defer r.Close()
+	go func() {
+		w.Write([]byte("delayed"))
+		w.Close()
+	}()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "delayed" {
+		t.Errorf("got %q, want %q", got, "delayed")
+	}
+	var total time.Duration
+	for _, d := range clock.Waits() {
+		total += d
+	}
+	if total < 50*time.Millisecond {
+		t.Errorf("total delay = %v, want at least 50ms", total)
+	}
+}
+
+func TestPipe_Next(t *testing.T) {
+	r, w := Pipe()
+	defer r.Close()
+	go func() {
+		io.WriteString(w, "first")
+		w.Close()
+	}()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(got) != "first" {
+		t.Errorf("got %q, want %q", got, "first")
+	}
+	// the write end is closed with the stream, so there are no more streams.
+	if err := r.Next(); err != io.EOF {
+		t.Errorf("Next() error = %v, want io.EOF", err)
+	}
+}
+
+func TestPipe_closeReader(t *testing.T) {
+	r, w := Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		// exceeds the pipe buffer, so blocks until the reader is closed.
+		_, err := w.Write(make([]byte, 2*pipeBufSz))
+		errc <- err
+	}()
+	if _, err := r.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("Write() error = nil, want error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write() is not unblocked by ConReader.Close")
+	}
+	if _, err := r.Read(make([]byte, 10)); err == nil {
+		t.Error("Read() after Close error = nil, want error")
+	}
+}
@@ -0,0 +1,82 @@
+package conio
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for the rate limiter.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After waits for the duration d to elapse and then sends the current
+	// time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock that uses the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// limiter is the token bucket rate limiter.  The bucket holds up to burst
+// tokens, and is refilled at rate tokens per second.  One token is one byte.
+// It is safe for concurrent use.
+type limiter struct {
+	rate  float64
+	burst float64
+	clock Clock
+
+	mu     sync.Mutex
+	tokens float64   // can be negative, if the waiters are in debt
+	last   time.Time // time of the last refill
+}
+
+// newLimiter creates a new limiter.  If burst is not positive, it is equal to
+// rate.
+func newLimiter(rate, burst int, clock Clock) *limiter {
+	if burst <= 0 {
+		burst = rate
+	}
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &limiter{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		clock:  clock,
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// wait takes n tokens from the bucket, waiting for them to be refilled if
+// necessary, or until ctx is done.  n may exceed burst, in which case the
+// wait is proportionally longer.
+func (l *limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens += float64(n) // refund
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-l.clock.After(time.Duration(deficit / l.rate * float64(time.Second))):
+		return nil
+	}
+}
@@ -0,0 +1,157 @@
+package conio
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is the Clock that advances instantly on After, and records the
+// waits.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.waits = append(c.waits, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// Advance advances the clock by d.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) Waits() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.waits
+}
+
+func Test_limiter_wait(t *testing.T) {
+	type step struct {
+		advance time.Duration // clock advance before the wait
+		n       int
+	}
+	tests := []struct {
+		name      string
+		rate      int
+		burst     int
+		steps     []step
+		wantWaits []time.Duration
+	}{
+		{"within burst", 100, 100, []step{{0, 50}, {0, 50}}, nil},
+		{"over burst", 100, 100, []step{{0, 100}, {0, 50}, {0, 100}}, []time.Duration{500 * time.Millisecond, time.Second}},
+		{"refill", 100, 100, []step{{0, 100}, {time.Second, 100}, {500 * time.Millisecond, 50}}, nil},
+		{"refill is capped by burst", 100, 100, []step{{10 * time.Second, 300}}, []time.Duration{2 * time.Second}},
+		{"frame larger than burst", 100, 0, []step{{0, 400}}, []time.Duration{3 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			l := newLimiter(tt.rate, tt.burst, clock)
+			for _, s := range tt.steps {
+				clock.Advance(s.advance)
+				if err := l.wait(context.Background(), s.n); err != nil {
+					t.Fatalf("limiter.wait() error = %v", err)
+				}
+			}
+			if got := clock.Waits(); !reflect.DeepEqual(got, tt.wantWaits) {
+				t.Errorf("waits = %v, want %v", got, tt.wantWaits)
+			}
+		})
+	}
+}
+
+func Test_limiter_waitCancel(t *testing.T) {
+	l := newLimiter(1, 1, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx, 1000); err != context.Canceled {
+		t.Errorf("limiter.wait() error = %v, want %v", err, context.Canceled)
+	}
+	if l.tokens != 1 {
+		t.Errorf("tokens = %v, want refunded to 1", l.tokens)
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	const (
+		rate    = 1000
+		frameSz = 100 - hdrSz // 100 bytes on the wire
+		frames  = 30
+	)
+	// the first second worth of frames passes within the burst, the rest is
+	// paced at one frame per 100ms.
+	wantTotal := time.Duration(frames-rate/100) * 100 * time.Millisecond
+
+	total := func(waits []time.Duration) (sum time.Duration) {
+		for _, d := range waits {
+			sum += d
+		}
+		return sum
+	}
+
+	var buf bytes.Buffer
+	wclock := newFakeClock()
+	w := NewWriter(&buf, WithRateLimit(rate, 0), WithClock(wclock))
+	for i := 0; i < frames; i++ {
+		if _, err := w.Write(make([]byte, frameSz)); err != nil {
+			t.Fatalf("ConWriter.Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ConWriter.Close() error = %v", err)
+	}
+	if got := total(wclock.Waits()); got != wantTotal {
+		t.Errorf("writer waited %v, want %v", got, wantTotal)
+	}
+
+	rclock := newFakeClock()
+	r := NewReader(&buf, WithRateLimit(rate, 0), WithClock(rclock))
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ConReader.Read() error = %v", err)
+	}
+	if len(got) != frames*frameSz {
+		t.Errorf("read %d bytes, want %d", len(got), frames*frameSz)
+	}
+	if got := total(rclock.Waits()); got != wantTotal {
+		t.Errorf("reader waited %v, want %v", got, wantTotal)
+	}
+}
+
+func TestWithRateLimit_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := NewWriter(ioutil.Discard, WithRateLimit(10, 10), WithContext(ctx))
+	if _, err := w.Write(make([]byte, 6)); err != nil {
+		t.Fatalf("ConWriter.Write() error = %v", err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := w.Write(make([]byte, 100)); err != context.Canceled {
+		t.Errorf("ConWriter.Write() error = %v, want %v", err, context.Canceled)
+	}
+}
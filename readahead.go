@@ -0,0 +1,267 @@
+package conio
+
+import (
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// readAhead reads the frames of ConReader in background, and, if the stream
+// is compressed, decodes them on several workers.  Frames are delivered in
+// stream order.
+type readAhead struct {
+	r       *ConReader
+	workers int // number of decompression workers to start
+	started bool
+
+	results chan *rjob // frames in stream order
+	jobs    chan *rjob // compressed frames for workers
+	stop    chan struct{}
+	once    sync.Once
+	pool    sync.Pool // *[]byte
+
+	mu       sync.Mutex // guards inflight
+	cond     *sync.Cond // signalled when inflight decreases
+	inflight int        // size of the frames read, but not consumed yet
+	limit    int        // maximum inflight, 0 means no limit
+}
+
+// rjob is the frame being decoded.  If err is set, it is the last frame.
+type rjob struct {
+	codec *codec  // compression of the frame, or nil
+	raw   *[]byte // frame payload
+	out   *[]byte // decoded frame buffer
+	data  []byte  // decoded data
+	err   error
+	// ready is closed when data or err is set.
+	ready chan struct{}
+}
+
+// newReadAhead starts reading ahead up to depth frames, with the total
+// payload size of at most limit bytes (unlimited if zero).
+func newReadAhead(r *ConReader, workers int, depth int, limit int) *readAhead {
+	if workers < 1 {
+		workers = 1
+	}
+	if depth < 1 {
+		depth = 2 * workers
+	}
+	ra := &readAhead{
+		r:       r,
+		workers: workers,
+		results: make(chan *rjob, depth),
+		jobs:    make(chan *rjob, workers),
+		stop:    make(chan struct{}),
+		limit:   limit,
+	}
+	ra.cond = sync.NewCond(&ra.mu)
+	ra.pool.New = func() interface{} { return new([]byte) }
+	go ra.produce()
+	return ra
+}
+
+// get returns the pooled buffer of size sz.
+func (ra *readAhead) get(sz int) *[]byte {
+	b := ra.pool.Get().(*[]byte)
+	if cap(*b) < sz {
+		*b = make([]byte, sz)
+	}
+	*b = (*b)[:sz]
+	return b
+}
+
+// allocStep is the size of the payload buffer allocated before the data is
+// received.  Larger payloads grow the buffer as the data arrives.
+const allocStep = 1 << 20
+
+// readPayload reads the frame payload of size bytes into the pooled buffer.
+// The buffer grows as the payload is received, so that the size in the
+// corrupted header can not make the reader allocate much more memory than the
+// stream holds.  size must be positive, so the end of the input is always
+// io.ErrUnexpectedEOF.  On error, the buffer is returned to the pool.
+func (ra *readAhead) readPayload(size int) (*[]byte, error) {
+	b := ra.pool.Get().(*[]byte)
+	buf := (*b)[:0]
+	if cap(buf) < min(size, allocStep) {
+		buf = make([]byte, 0, min(size, allocStep))
+	}
+	for len(buf) < size {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		n, err := io.ReadFull(ra.r.r, buf[len(buf):min(size, cap(buf))])
+		buf = buf[:len(buf)+n]
+		if err != nil {
+			if err == io.EOF {
+				// the stream is cut in the middle of the frame.
+				err = io.ErrUnexpectedEOF
+			}
+			*b = buf[:0]
+			ra.pool.Put(b)
+			return nil, err
+		}
+	}
+	*b = buf
+	return b, nil
+}
+
+// release returns the frame buffers to the pool.
+func (ra *readAhead) release(job *rjob) {
+	if job == nil {
+		return
+	}
+	if job.raw != nil {
+		ra.free(len(*job.raw))
+		ra.pool.Put(job.raw)
+	}
+	if job.out != nil {
+		ra.pool.Put(job.out)
+	}
+}
+
+// acquire waits until sz more bytes can be read ahead without exceeding the
+// limit.  A frame larger than the limit is allowed if nothing else is in
+// flight.  It returns false if the read-ahead is stopped.
+func (ra *readAhead) acquire(sz int) bool {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	for ra.limit > 0 && ra.inflight > 0 && ra.inflight+sz > ra.limit {
+		select {
+		case <-ra.stop:
+			return false
+		default:
+		}
+		ra.cond.Wait()
+	}
+	ra.inflight += sz
+	return true
+}
+
+// free releases sz bytes acquired by acquire.
+func (ra *readAhead) free(sz int) {
+	ra.mu.Lock()
+	ra.inflight -= sz
+	ra.mu.Unlock()
+	ra.cond.Signal()
+}
+
+// produce reads the frames from the underlying reader until the end of the
+// stream, an error, or until the read-ahead is stopped.
+func (ra *readAhead) produce() {
+	defer func() {
+		if ra.started {
+			close(ra.jobs)
+		}
+	}()
+	defer close(ra.results)
+	for {
+		size, err := ra.r.nextFrame()
+		if err == nil && size == 0 {
+			continue // control frame
+		}
+		job := &rjob{codec: ra.r.codec, ready: make(chan struct{})}
+		if err == nil {
+			err = ra.r.pace(size)
+		}
+		if err == nil {
+			if !ra.acquire(size) {
+				return
+			}
+			if job.raw, err = ra.readPayload(size); err != nil {
+				ra.free(size)
+			} else {
+				ra.r.frameSum = crc32.ChecksumIEEE(*job.raw)
+			}
+		}
+		if err != nil {
+			job.err = err
+			close(job.ready)
+			select {
+			case ra.results <- job:
+			case <-ra.stop:
+			}
+			return
+		}
+		if job.codec == nil {
+			job.data = *job.raw
+			close(job.ready)
+		}
+		select {
+		case ra.results <- job:
+		case <-ra.stop:
+			return
+		}
+		if job.codec != nil {
+			if !ra.started {
+				ra.started = true
+				for i := 0; i < ra.workers; i++ {
+					go ra.work()
+				}
+			}
+			ra.jobs <- job
+		}
+	}
+}
+
+// work decodes the frames.
+func (ra *readAhead) work() {
+	var d inflater
+	for job := range ra.jobs {
+		job.out = ra.get(0)
+		job.data, job.err = d.decode(*job.out, *job.raw, job.codec.blockSz)
+		if job.err == nil {
+			*job.out = job.data // keep the grown buffer
+		}
+		close(job.ready)
+	}
+}
+
+// next returns the next decoded frame.
+func (ra *readAhead) next() *rjob {
+	job, ok := <-ra.results
+	if !ok {
+		return &rjob{err: errReaderClosed}
+	}
+	<-job.ready
+	return job
+}
+
+// close stops the read-ahead.
+func (ra *readAhead) close() {
+	ra.once.Do(func() {
+		close(ra.stop)
+		ra.mu.Lock()
+		ra.cond.Broadcast()
+		ra.mu.Unlock()
+	})
+}
+
+// readAhead reads the decoded data into p.
+func (r *ConReader) readAhead(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for len(r.pending) == 0 {
+		r.ra.release(r.cur)
+		r.cur = r.ra.next()
+		if err := r.cur.err; err != nil {
+			r.ra.release(r.cur)
+			r.cur = nil
+			if err == io.EOF {
+				return 0, r.finish()
+			}
+			r.err = err
+			return 0, err
+		}
+		if err := r.checkSize(len(r.cur.data)); err != nil {
+			r.err = err
+			return 0, err
+		}
+		r.pending = r.cur.data
+		r.frame = len(r.cur.data)
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	r.account(p[:n])
+	return n, nil
+}
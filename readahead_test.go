@@ -0,0 +1,109 @@
+package conio
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConReader_prefetch(t *testing.T) {
+	frames := make([]string, 50)
+	for i := range frames {
+		frames[i] = strings.Repeat(string(rune('a'+i%26)), 1000)
+	}
+	var buf bytes.Buffer
+	writeStream(t, NewWriter(&buf), frames...)
+	stream, data := buf.Bytes(), []byte(strings.Join(frames, ""))
+	tests := []struct {
+		name   string
+		frames int
+		limit  int
+	}{
+		{"one frame", 1, 0},
+		{"unlimited", 16, 0},
+		{"limited", 16, 2500},
+		{"limit below frame size", 16, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(bytes.NewReader(stream), WithPrefetch(tt.frames, tt.limit))
+			defer r.Close()
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ConReader.Read() error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("ConReader.Read() returned %d bytes, different from %d bytes written", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestConReader_prefetchLimit(t *testing.T) {
+	const frameSz = 100
+	frames := make([]string, 10)
+	for i := range frames {
+		frames[i] = strings.Repeat("x", frameSz)
+	}
+	var buf bytes.Buffer
+	writeStream(t, NewWriter(&buf), frames...)
+	cr := &countingReader{r: bytes.NewReader(buf.Bytes())}
+	r := NewReader(cr, WithPrefetch(8, 2*frameSz+50))
+	defer r.Close()
+
+	p := make([]byte, 1)
+	if _, err := r.Read(p); err != nil {
+		t.Fatalf("ConReader.Read() error = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond) // let the prefetcher run into the limit
+	// two frames in flight, and the header of the third frame.
+	if got, max := atomic.LoadInt64(&cr.n), int64(2*(hdrSz+frameSz)+hdrSz); got > max {
+		t.Errorf("prefetched %d bytes, want at most %d", got, max)
+	}
+}
+
+func TestConReader_prefetchClose(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		w := NewWriter(pw)
+		for {
+			if _, err := w.Write(make([]byte, 100)); err != nil {
+				return
+			}
+		}
+	}()
+	r := NewReader(pr, WithPrefetch(2, 0))
+	p := make([]byte, 10)
+	if _, err := r.Read(p); err != nil {
+		t.Fatalf("ConReader.Read() error = %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("ConReader.Close() error = %v", err)
+	}
+	// drain the frames that were read before the close.
+	var err error
+	for err == nil {
+		_, err = r.Read(p)
+	}
+	if err != errReaderClosed {
+		t.Errorf("ConReader.Read() error = %v, want %v", err, errReaderClosed)
+	}
+	pr.Close()
+}
+
+// countingReader counts the bytes read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
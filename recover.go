@@ -0,0 +1,277 @@
+package conio
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Damage is the damaged region of the stream found by RecoveryReader.
+type Damage struct {
+	Offset int64 // offset of the first damaged byte in the input
+	Length int64 // length of the damaged region
+	Err    error // the reason why the region is considered damaged
+}
+
+func (d Damage) String() string {
+	return fmt.Sprintf("%d bytes at offset %d: %v", d.Length, d.Offset, d.Err)
+}
+
+// errNoClosedHeader is reported if the input ends without the closed header.
+var errNoClosedHeader = errors.New("closed header is missing")
+
+// resyncWindow is the size of the window in which RecoveryReader scans for
+// the next intact frame.
+const resyncWindow = 64 << 10
+
+// RecoveryReader is the lenient reader of the damaged stream, such as the
+// file left by the crashed process.  It returns the data of all intact
+// frames, and skips the damaged regions, which are reported by Damage.
+//
+// Without the frame checksums, the frames can not be verified, so the
+// stream is read up to the first frame that is truncated or malformed, and
+// the rest of the input is reported as damaged.  If the stream has been
+// written with WithFrameChecksum, each frame is verified against its
+// checksum, and after the damaged region, RecoveryReader resynchronises:
+// it scans the input for the next data frame that is followed by the
+// matching checksum, and continues from there.
+//
+// RecoveryReader does not verify the size hint and the checksum trailer of
+// the stream, as the recovered data is expected to be incomplete.
+type RecoveryReader struct {
+	r    io.ReaderAt
+	size int64
+	off  int64 // offset of the next frame header
+
+	codec *codec // compression of the data frames, if any
+	dec   inflater
+	sums  bool // the stream has the frame checksums
+
+	pending []byte // unread data of the current frame
+	damage  []Damage
+	done    bool
+}
+
+// NewRecoveryReader creates a new RecoveryReader reading the stream of size
+// bytes from r.
+func NewRecoveryReader(r io.ReaderAt, size int64) *RecoveryReader {
+	return &RecoveryReader{r: r, size: size}
+}
+
+// Damage returns the damaged regions found so far.
+func (r *RecoveryReader) Damage() []Damage {
+	return r.damage
+}
+
+// Read reads the data of the intact frames.  It returns io.EOF at the closed
+// header, or at the end of input.
+func (r *RecoveryReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err == io.EOF {
+			r.done = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// readAt reads n bytes at offset off.
+func (r *RecoveryReader) readAt(n int, off int64) ([]byte, error) {
+	p := make([]byte, n)
+	if m, err := r.r.ReadAt(p, off); err != nil && !(err == io.EOF && m == n) {
+		return nil, unexpected(err)
+	}
+	return p, nil
+}
+
+// next reads the next intact data frame into r.pending.  It returns io.EOF
+// if there are no more intact frames.
+func (r *RecoveryReader) next() error {
+	for {
+		if r.off+hdrSz > r.size {
+			err := errNoClosedHeader
+			if r.off < r.size {
+				err = io.ErrUnexpectedEOF
+			}
+			r.damage = append(r.damage, Damage{Offset: r.off, Length: r.size - r.off, Err: err})
+			return io.EOF
+		}
+		p, err := r.readAt(hdrSz, r.off)
+		if err != nil {
+			return err
+		}
+		hdr := must(loadHeader(p))
+		end := r.off + hdrSz + int64(hdr.Size())
+		if end > r.size {
+			if !r.corrupt(r.off, io.ErrUnexpectedEOF) {
+				return io.EOF
+			}
+			continue
+		}
+		switch frameType(hdr) {
+		case FrameClosed:
+			return io.EOF
+		case FrameHeartbeat:
+			r.off = end
+		case FrameControl:
+			if err := r.control(hdr.Size()); err != nil {
+				if errors.Is(err, errInvalidControl) || errors.Is(err, errUnknownControl) {
+					if !r.corrupt(r.off, err) {
+						return io.EOF
+					}
+					continue
+				}
+				return err
+			}
+			r.off = end
+		case FrameData:
+			data, next, err := r.data(hdr.Size())
+			if err != nil {
+				if errors.Is(err, ErrChecksum) || errors.Is(err, errBlockSize) || errors.Is(err, errDecompress) {
+					if !r.corrupt(r.off, err) {
+						return io.EOF
+					}
+					continue
+				}
+				return err
+			}
+			r.pending, r.off = data, next
+			return nil
+		}
+	}
+}
+
+// control processes the control frame of the given size at r.off.
+func (r *RecoveryReader) control(size int) error {
+	if size > maxCtlSz {
+		return fmt.Errorf("%w: size %d", errInvalidControl, size)
+	}
+	p, err := r.readAt(size, r.off+hdrSz)
+	if err != nil {
+		return err
+	}
+	if p[0] == ctlCompress {
+		c, err := loadCodec(p[1:])
+		if err != nil {
+			return err
+		}
+		r.codec = c
+		return nil
+	}
+	_, _, err = describeControl(p)
+	return err
+}
+
+// errDecompress is returned by data if the frame can not be decompressed.
+var errDecompress = errors.New("frame can not be decompressed")
+
+// data reads and verifies the data frame of the given size at r.off, and
+// returns its data and the offset of the frame that follows it.
+func (r *RecoveryReader) data(size int) ([]byte, int64, error) {
+	payload, err := r.readAt(size, r.off+hdrSz)
+	if err != nil {
+		return nil, 0, err
+	}
+	next := r.off + hdrSz + int64(size)
+	sum, ok, err := r.frameSum(next)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case ok:
+		r.sums = true
+		next += frameSumSz
+		if sum != crc32.ChecksumIEEE(payload) {
+			return nil, 0, fmt.Errorf("%w: frame checksum", ErrChecksum)
+		}
+	case r.sums:
+		return nil, 0, fmt.Errorf("%w: frame checksum is missing", ErrChecksum)
+	}
+	if r.codec == nil {
+		return payload, next, nil
+	}
+	data, err := r.dec.decode(nil, payload, r.codec.blockSz)
+	if err != nil {
+		if errors.Is(err, errBlockSize) {
+			return nil, 0, err
+		}
+		return nil, 0, fmt.Errorf("%w: %v", errDecompress, err)
+	}
+	return data, next, nil
+}
+
+// frameSum reads the frame checksum at offset off, if there is one.
+func (r *RecoveryReader) frameSum(off int64) (uint32, bool, error) {
+	if off+frameSumSz > r.size {
+		return 0, false, nil
+	}
+	p, err := r.readAt(frameSumSz, off)
+	if err != nil {
+		return 0, false, err
+	}
+	hdr := must(loadHeader(p))
+	if !hdr.IsClosed() || hdr.Size() != frameSumSz-hdrSz || p[hdrSz] != ctlFrameSum {
+		return 0, false, nil
+	}
+	return endianness.Uint32(p[hdrSz+1:]), true, nil
+}
+
+// corrupt records the damage that starts at offset at, and tries to find
+// the next intact frame.  It returns false if there is none.
+func (r *RecoveryReader) corrupt(at int64, reason error) bool {
+	pos, ok := r.resync(at + 1)
+	if !ok {
+		pos = r.size
+	}
+	r.damage = append(r.damage, Damage{Offset: at, Length: pos - at, Err: reason})
+	r.off = pos
+	return ok
+}
+
+// resync scans the input starting at offset from for the data frame that
+// is followed by the matching frame checksum, or for the closed header at
+// the end of input.
+func (r *RecoveryReader) resync(from int64) (int64, bool) {
+	buf := make([]byte, resyncWindow)
+	for base := from; base+hdrSz <= r.size; base += resyncWindow - hdrSz + 1 {
+		n, err := r.r.ReadAt(buf, base)
+		if err != nil && err != io.EOF {
+			return 0, false
+		}
+		for i := 0; i+hdrSz <= n; i++ {
+			if r.candidate(base+int64(i), buf[i:i+hdrSz]) {
+				return base + int64(i), true
+			}
+		}
+		if n < len(buf) {
+			break
+		}
+	}
+	return 0, false
+}
+
+// candidate returns true if the header p at offset off starts the intact
+// frame.
+func (r *RecoveryReader) candidate(off int64, p []byte) bool {
+	hdr := must(loadHeader(p))
+	switch frameType(hdr) {
+	case FrameClosed:
+		return off+hdrSz == r.size
+	case FrameData:
+		end := off + hdrSz + int64(hdr.Size())
+		sum, ok, err := r.frameSum(end)
+		if err != nil || !ok {
+			return false
+		}
+		payload, err := r.readAt(hdr.Size(), off+hdrSz)
+		return err == nil && crc32.ChecksumIEEE(payload) == sum
+	}
+	return false
+}
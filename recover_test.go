@@ -0,0 +1,97 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// frameData returns the data of frames with the given indexes.
+func frameData(idx ...int) string {
+	var s string
+	for _, i := range idx {
+		s += fmt.Sprintf("frame-%02d", i)
+	}
+	return s
+}
+
+func TestRecoveryReader(t *testing.T) {
+	const (
+		plainSz  = hdrSz + 8              // plain frame size
+		summedSz = hdrSz + 8 + frameSumSz // frame size with checksum
+	)
+	// the stream of frames "frame-00" to "frame-04".
+	stream := func(opts ...Option) []byte {
+		var buf bytes.Buffer
+		writeStream(t, NewWriter(&buf, opts...), frameData(0), frameData(1), frameData(2), frameData(3), frameData(4))
+		return buf.Bytes()
+	}
+	plain := stream()
+	summed := stream(WithFrameChecksum())
+	modify := func(p []byte, fn func(p []byte) []byte) []byte {
+		return fn(append([]byte(nil), p...))
+	}
+	tests := []struct {
+		name       string
+		stream     []byte
+		want       string
+		wantDamage []Damage
+	}{
+		{"intact", plain, frameData(0, 1, 2, 3, 4), nil},
+		{"intact summed", summed, frameData(0, 1, 2, 3, 4), nil},
+		{"intact compressed", stream(WithCompression(flate.BestSpeed), WithFrameChecksum()),
+			frameData(0, 1, 2, 3, 4), nil},
+		{"truncated", plain[:3*plainSz+5], frameData(0, 1, 2),
+			[]Damage{{3 * plainSz, 5, io.ErrUnexpectedEOF}}},
+		{"no closed header", plain[:5*plainSz], frameData(0, 1, 2, 3, 4),
+			[]Damage{{5 * plainSz, 0, errNoClosedHeader}}},
+		{"corrupt header", modify(plain, func(p []byte) []byte { p[plainSz+1] = 0xff; return p }), frameData(0),
+			[]Damage{{plainSz, int64(len(plain)) - plainSz - hdrSz, io.ErrUnexpectedEOF}}},
+		{"summed truncated", summed[:2*summedSz+10], frameData(0, 1),
+			[]Damage{{2 * summedSz, 10, io.ErrUnexpectedEOF}}},
+		{"summed corrupt payload", modify(summed, func(p []byte) []byte { p[summedSz+hdrSz] = 'F'; return p }),
+			frameData(0, 2, 3, 4),
+			[]Damage{{summedSz, summedSz, ErrChecksum}}},
+		{"summed corrupt header", modify(summed, func(p []byte) []byte { p[2*summedSz+1] = 0xff; return p }),
+			frameData(0, 1, 3, 4),
+			[]Damage{{2 * summedSz, summedSz, io.ErrUnexpectedEOF}}},
+		{"summed garbage", modify(summed, func(p []byte) []byte {
+			return append(p[:summedSz:summedSz], append([]byte("garbage\x00\x00\x00\x80"), p[summedSz:]...)...)
+		}), frameData(0, 1, 2, 3, 4),
+			[]Damage{{summedSz, 11, io.ErrUnexpectedEOF}}},
+		{"summed missing sum", modify(summed, func(p []byte) []byte {
+			return append(p[:3*summedSz-frameSumSz:3*summedSz-frameSumSz], p[3*summedSz:]...)
+		}), frameData(0, 1, 3, 4),
+			[]Damage{{2 * summedSz, summedSz - frameSumSz, ErrChecksum}}},
+		{"summed unknown control", modify(summed, func(p []byte) []byte {
+			return append(p[:summedSz:summedSz], append(ctlFrame(0x7f, nil), p[summedSz:]...)...)
+		}), frameData(0, 1, 2, 3, 4),
+			[]Damage{{summedSz, 5, errUnknownControl}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRecoveryReader(bytes.NewReader(tt.stream), int64(len(tt.stream)))
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("RecoveryReader.Read() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("RecoveryReader.Read() = %q, want %q", got, tt.want)
+			}
+			damage := r.Damage()
+			for i := range damage {
+				if i < len(tt.wantDamage) && errors.Is(damage[i].Err, tt.wantDamage[i].Err) {
+					damage[i].Err = tt.wantDamage[i].Err
+				}
+			}
+			if !reflect.DeepEqual(damage, tt.wantDamage) {
+				t.Errorf("RecoveryReader.Damage() = %v, want %v", damage, tt.wantDamage)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package conio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// Bufferer is implemented by decoders that read ahead from the underlying
+// reader, and expose the data buffered, but not consumed yet, such as
+// json.Decoder.
+type Bufferer interface {
+	Buffered() io.Reader
+}
+
+// Rejoin returns the reader that continues where the decoder b stopped: it
+// yields the data buffered by b, followed by the data from r, the reader b
+// was reading from.  Use it to create ConReader after decoding the message
+// with b, and then to create the next decoder after the end of the stream.
+// ConReader never reads past the closed header, so the data that follows
+// the stream is returned by the same reader.
+func Rejoin(b Bufferer, r io.Reader) io.Reader {
+	return io.MultiReader(b.Buffered(), r)
+}
+
+// RejoinJSON is Rejoin for json.Decoder reading the values written by
+// json.Encoder.  Encoder terminates each value with a newline that Decoder
+// does not consume, so the returned reader discards it.  The newline is
+// dropped on the first Read, so that RejoinJSON does not block waiting for
+// the data that the peer may only send later.  It must not be used if the
+// values are written without the trailing newline, as the first byte of the
+// stream could be a newline as well.
+func RejoinJSON(dec *json.Decoder, r io.Reader) io.Reader {
+	return &newlineSkipper{r: Rejoin(dec, r)}
+}
+
+// newlineSkipper drops the leading newline of r.
+type newlineSkipper struct {
+	r       io.Reader
+	started bool // the first byte has been read
+}
+
+func (s *newlineSkipper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if s.started || n == 0 {
+		return n, err
+	}
+	s.started = true
+	if p[0] != '\n' {
+		return n, err
+	}
+	n = copy(p, p[1:n])
+	if n == 0 && err == nil {
+		return s.r.Read(p)
+	}
+	return n, err
+}
+
+// RejoinBufio returns the reader that yields the data buffered by br,
+// followed by the data from r, the reader br was reading from.  The buffered
+// data is consumed from br.
+//
+// It is only necessary if the data must be read past the br buffer, i.e.
+// when switching to the unbuffered reads.  Otherwise, ConReader can be
+// created directly over br.
+func RejoinBufio(br *bufio.Reader, r io.Reader) io.Reader {
+	n := br.Buffered()
+	buffered := make([]byte, n)
+	br.Read(buffered) // reads exactly n buffered bytes
+	return io.MultiReader(bytes.NewReader(buffered), r)
+}
@@ -0,0 +1,215 @@
+package conio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+type testMsg struct {
+	Name string
+	Size int
+}
+
+// sendMixed encodes the message, the conio stream with data, and another
+// message, and sends them with a single write to conn, so that a decoder that
+// reads ahead is guaranteed to buffer the beginning of the stream.
+func sendMixed(conn io.Writer, encode func(interface{}) error, buf *bytes.Buffer, data []byte) error {
+	if err := encode(testMsg{"before", len(data)}); err != nil {
+		return err
+	}
+	w := NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := encode(testMsg{"after", 0}); err != nil {
+		return err
+	}
+	_, err := conn.Write(buf.Bytes())
+	return err
+}
+
+func TestRejoinJSON(t *testing.T) {
+	// frame of size 10 starts with a newline.
+	frame := append(must(newBinHeader(10, false)).Bytes(), "0123456789"...)
+	short := append(must(newBinHeader(4, false)).Bytes(), "0123"...)
+	tests := []struct {
+		name string
+		data string
+		want []byte
+	}{
+		{"newline", "{}\n" + string(frame), frame},
+		{"no newline", "{}" + string(short), short},
+		{"eof", "{}", nil},
+		{"newline only", "{}\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader([]byte(tt.data))
+			dec := json.NewDecoder(r)
+			if err := dec.Decode(&struct{}{}); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			rest := RejoinJSON(dec, iotest.OneByteReader(r))
+			got, err := ioutil.ReadAll(rest)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("RejoinJSON() = % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejoinJSON_lazy(t *testing.T) {
+	// the peer sends the stream only after the reply.
+	pr, pw := io.Pipe()
+	go io.WriteString(pw, "{}\n")
+	dec := json.NewDecoder(pr)
+	if err := dec.Decode(&struct{}{}); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	done := make(chan io.Reader, 1)
+	go func() { done <- RejoinJSON(dec, pr) }()
+	var rest io.Reader
+	select {
+	case rest = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RejoinJSON blocks reading the connection")
+	}
+	var buf bytes.Buffer
+	writeStream(t, NewWriter(&buf), "reply")
+	go func() {
+		pw.Write(buf.Bytes())
+		pw.Close()
+	}()
+	got, err := ioutil.ReadAll(NewReader(rest))
+	if err != nil {
+		t.Fatalf("ConReader.Read() error = %v", err)
+	}
+	if string(got) != "reply" {
+		t.Errorf("ConReader.Read() = %q, want %q", got, "reply")
+	}
+}
+
+func TestRejoin(t *testing.T) {
+	data := testText(1000)
+	tests := []struct {
+		name string
+		// encoder returns the encode function writing to buf.
+		encoder func(buf *bytes.Buffer) func(interface{}) error
+		// receive decodes the first message, reads the stream, and decodes the
+		// second message.
+		receive func(t *testing.T, conn io.Reader) (first testMsg, stream []byte, second testMsg)
+	}{
+		{"json",
+			func(buf *bytes.Buffer) func(interface{}) error { return json.NewEncoder(buf).Encode },
+			func(t *testing.T, conn io.Reader) (first testMsg, stream []byte, second testMsg) {
+				dec := json.NewDecoder(conn)
+				if err := dec.Decode(&first); err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				if n, _ := io.Copy(ioutil.Discard, dec.Buffered()); n == 0 {
+					t.Fatal("decoder has not buffered the stream")
+				}
+				rest := RejoinJSON(dec, conn)
+				stream, err := ioutil.ReadAll(NewReader(rest))
+				if err != nil {
+					t.Fatalf("ConReader.Read() error = %v", err)
+				}
+				if err := json.NewDecoder(rest).Decode(&second); err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				return first, stream, second
+			},
+		},
+		{"gob",
+			func(buf *bytes.Buffer) func(interface{}) error { return gob.NewEncoder(buf).Encode },
+			func(t *testing.T, conn io.Reader) (first testMsg, stream []byte, second testMsg) {
+				br := bufio.NewReader(conn)
+				dec := gob.NewDecoder(br)
+				if err := dec.Decode(&first); err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				if br.Buffered() == 0 {
+					t.Fatal("bufio.Reader has not buffered the stream")
+				}
+				stream, err := ioutil.ReadAll(NewReader(br))
+				if err != nil {
+					t.Fatalf("ConReader.Read() error = %v", err)
+				}
+				if err := dec.Decode(&second); err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				return first, stream, second
+			},
+		},
+		{"lines unbuffered",
+			func(buf *bytes.Buffer) func(interface{}) error {
+				return func(v interface{}) error {
+					msg := v.(testMsg)
+					_, err := fmt.Fprintf(buf, "%s %d\n", msg.Name, msg.Size)
+					return err
+				}
+			},
+			func(t *testing.T, conn io.Reader) (first testMsg, stream []byte, second testMsg) {
+				br := bufio.NewReader(conn)
+				line, err := br.ReadString('\n')
+				if err != nil {
+					t.Fatalf("ReadString() error = %v", err)
+				}
+				fmt.Sscan(line, &first.Name, &first.Size)
+				rest := RejoinBufio(br, conn)
+				if br.Buffered() != 0 {
+					t.Fatal("RejoinBufio has not consumed the buffered data")
+				}
+				stream, err = ioutil.ReadAll(NewReader(rest))
+				if err != nil {
+					t.Fatalf("ConReader.Read() error = %v", err)
+				}
+				if _, err := fmt.Fscanln(rest, &second.Name, &second.Size); err != nil {
+					t.Fatalf("Fscanln() error = %v", err)
+				}
+				return first, stream, second
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			errC := make(chan error, 1)
+			go func() {
+				var buf bytes.Buffer
+				errC <- sendMixed(server, tt.encoder(&buf), &buf, data)
+			}()
+			first, stream, second := tt.receive(t, client)
+			if first.Name != "before" || first.Size != len(data) {
+				t.Errorf("first message = %v", first)
+			}
+			if !bytes.Equal(stream, data) {
+				t.Errorf("stream = %q, want %q", stream, data)
+			}
+			if second.Name != "after" {
+				t.Errorf("second message = %v", second)
+			}
+			if err := <-errC; err != nil {
+				t.Errorf("send error = %v", err)
+			}
+		})
+	}
+}
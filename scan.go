@@ -0,0 +1,183 @@
+package conio
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// FrameType is the type of the frame.
+type FrameType int
+
+// frame types.
+const (
+	FrameData      FrameType = iota // data frame
+	FrameHeartbeat                  // heartbeat, a data frame with no data
+	FrameControl                    // control frame
+	FrameClosed                     // closed header, the end of the stream
+)
+
+var frameTypes = [...]string{
+	FrameData:      typData,
+	FrameHeartbeat: typHeartbeat,
+	FrameControl:   typControl,
+	FrameClosed:    typClosed,
+}
+
+func (t FrameType) String() string {
+	if t < 0 || int(t) >= len(frameTypes) {
+		return fmt.Sprintf("FrameType(%d)", int(t))
+	}
+	return frameTypes[t]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t FrameType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Frame describes the frame of the stream.
+type Frame struct {
+	Index  int64     `json:"index"`  // index of the frame in the input
+	Offset int64     `json:"offset"` // offset of the header in the input
+	Size   int       `json:"size"`   // payload size
+	Closed bool      `json:"closed"` // closed flag
+	Type   FrameType `json:"type"`
+	// Kind is the name of the control frame kind, such as "size_hint", or
+	// "unknown".  It is empty for other frames.
+	Kind string `json:"kind,omitempty"`
+	// Detail is the decoded content of the control frame, such as
+	// "size=10".  If the content is invalid, it describes the error.
+	Detail string `json:"detail,omitempty"`
+	// Payload is the payload of the control frame.  It is nil for other
+	// frames.
+	Payload []byte `json:"-"`
+}
+
+// FrameScanner reads the frames from the raw stream, without interpreting
+// them.  It is a debugging aid:  unlike ConReader, it does not stop at the
+// closed header, and continues with the following stream, if any, and does
+// not fail on the invalid control frames.
+type FrameScanner struct {
+	r   io.Reader
+	idx int64
+	off int64
+}
+
+// NewFrameScanner creates a new FrameScanner reading from r.
+func NewFrameScanner(r io.Reader) *FrameScanner {
+	return &FrameScanner{r: r}
+}
+
+// Offset returns the number of bytes consumed from the underlying reader.
+func (s *FrameScanner) Offset() int64 {
+	return s.off
+}
+
+// Next reads the next frame.  The payload of the data frame is skipped.  It
+// returns io.EOF if the input ends at the frame boundary, and
+// io.ErrUnexpectedEOF if it ends in the middle of the frame.
+func (s *FrameScanner) Next() (Frame, error) {
+	hdr, err := readHeader(s.r)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Frame{}, fmt.Errorf("incomplete header at offset %d: %w", s.off, err)
+		}
+		return Frame{}, err
+	}
+	f := Frame{
+		Index:  s.idx,
+		Offset: s.off,
+		Size:   hdr.Size(),
+		Closed: hdr.IsClosed(),
+		Type:   frameType(hdr),
+	}
+	s.idx++
+	s.off += hdrSz
+	if f.Type == FrameControl && f.Size <= maxCtlSz {
+		f.Payload = make([]byte, f.Size)
+		n, err := io.ReadFull(s.r, f.Payload)
+		s.off += int64(n)
+		if err != nil {
+			return f, fmt.Errorf("incomplete frame at offset %d: %w", f.Offset, unexpected(err))
+		}
+		f.Kind, f.Detail, err = describeControl(f.Payload)
+		if err != nil {
+			f.Detail = err.Error()
+		}
+		return f, nil
+	}
+	n, err := io.CopyN(ioutil.Discard, s.r, int64(f.Size))
+	s.off += n
+	if err != nil {
+		return f, fmt.Errorf("incomplete frame at offset %d: %w", f.Offset, unexpected(err))
+	}
+	if f.Type == FrameControl {
+		f.Kind, f.Detail = "unknown", fmt.Sprintf("%v: size %d", errInvalidControl, f.Size)
+	}
+	return f, nil
+}
+
+// unexpected converts io.EOF to io.ErrUnexpectedEOF.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func frameType(hdr *binheader) FrameType {
+	switch {
+	case hdr.IsClosed() && hdr.Size() == 0:
+		return FrameClosed
+	case hdr.IsClosed():
+		return FrameControl
+	case hdr.Size() == 0:
+		return FrameHeartbeat
+	}
+	return FrameData
+}
+
+// describeControl returns the name of the control frame kind and its
+// decoded content, or the error, if the content is invalid.
+func describeControl(p []byte) (kind string, detail string, err error) {
+	body := p[1:]
+	switch p[0] {
+	case ctlAck:
+		a, err := loadTrailer(body)
+		if err != nil {
+			return "ack", "", err
+		}
+		return "ack", fmt.Sprintf("bytes=%d crc32=%08x", a.n, a.sum), nil
+	case ctlCompress:
+		c, err := loadCodec(body)
+		if err != nil {
+			return "compress", "", err
+		}
+		return "compress", fmt.Sprintf("alg=deflate block=%d", c.blockSz), nil
+	case ctlSizeHint:
+		n, err := loadSizeHint(body)
+		if err != nil {
+			return "size_hint", "", err
+		}
+		return "size_hint", fmt.Sprintf("size=%d", n), nil
+	case ctlChecksum:
+		if err := loadChecksum(body); err != nil {
+			return "checksum", "", err
+		}
+		return "checksum", "alg=crc32", nil
+	case ctlTrailer:
+		t, err := loadTrailer(body)
+		if err != nil {
+			return "trailer", "", err
+		}
+		return "trailer", fmt.Sprintf("bytes=%d crc32=%08x", t.n, t.sum), nil
+	case ctlFrameSum:
+		sum, err := loadFrameSum(body)
+		if err != nil {
+			return "frame_sum", "", err
+		}
+		return "frame_sum", fmt.Sprintf("crc32=%08x", sum), nil
+	}
+	return "unknown", "", fmt.Errorf("%w: kind %d", errUnknownControl, p[0])
+}
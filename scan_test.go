@@ -0,0 +1,69 @@
+package conio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestFrameScanner(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithSizeHint(3), WithChecksum())
+	w.Write([]byte{1, 2, 3})
+	w.Close()
+	stream := buf.Bytes()
+
+	tests := []struct {
+		name    string
+		input   []byte
+		want    []Frame
+		wantErr error
+	}{
+		{"stream", stream, []Frame{
+			{Index: 0, Offset: 0, Size: 9, Closed: true, Type: FrameControl, Kind: "size_hint", Detail: "size=3"},
+			{Index: 1, Offset: 13, Size: 2, Closed: true, Type: FrameControl, Kind: "checksum", Detail: "alg=crc32"},
+			{Index: 2, Offset: 19, Size: 3, Type: FrameData},
+			{Index: 3, Offset: 26, Size: 13, Closed: true, Type: FrameControl, Kind: "trailer", Detail: "bytes=3 crc32=55bc801d"},
+			{Index: 4, Offset: 43, Size: 0, Closed: true, Type: FrameClosed},
+		}, io.EOF},
+		{"heartbeat and unknown", []byte{0, 0, 0, 0, 1, 0, 0, 0x80, 0xff}, []Frame{
+			{Index: 0, Offset: 0, Type: FrameHeartbeat},
+			{Index: 1, Offset: 4, Size: 1, Closed: true, Type: FrameControl, Kind: "unknown", Detail: "unknown control frame: kind 255"},
+		}, io.EOF},
+		{"truncated payload", []byte{4, 0, 0, 0, 1, 2}, []Frame{
+			{Index: 0, Offset: 0, Size: 4, Type: FrameData},
+		}, io.ErrUnexpectedEOF},
+		{"truncated header", []byte{0, 0, 0, 0, 1, 2}, []Frame{
+			{Index: 0, Offset: 0, Type: FrameHeartbeat},
+		}, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewFrameScanner(bytes.NewReader(tt.input))
+			var (
+				got []Frame
+				err error
+			)
+			for {
+				var f Frame
+				f, err = s.Next()
+				if err != nil {
+					if f.Offset > 0 || f.Size > 0 {
+						got = append(got, f)
+					}
+					break
+				}
+				f.Payload = nil
+				got = append(got, f)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("FrameScanner.Next() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("frames = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
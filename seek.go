@@ -0,0 +1,201 @@
+package conio
+
+import (
+	"errors"
+	"io"
+	"math"
+	"sort"
+)
+
+// ErrNotSeekable is returned by ConReader.Seek if the underlying reader is
+// not an io.Seeker, or the stream can not be read at random:  it is
+// compressed, prefetched, or acknowledged.
+var ErrNotSeekable = errors.New("stream is not seekable")
+
+// frameLoc is the location of the data frame in the stream.
+type frameLoc struct {
+	off     int64 // offset of the frame header from the stream start
+	logical int64 // offset of the frame data in the logical payload
+	size    int   // data size
+}
+
+// end returns the logical offset of the end of the frame data.
+func (f frameLoc) end() int64 {
+	return f.logical + int64(f.size)
+}
+
+// initSeek enables seeking, if the underlying reader is seekable.
+func (r *ConReader) initSeek() {
+	s, ok := r.r.(io.Seeker)
+	if !ok {
+		return
+	}
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		// e.g. os.Stdin attached to a pipe.
+		return
+	}
+	r.seeker, r.base = s, pos
+}
+
+// record records the location of the data frame, unless it is already
+// known.
+func (r *ConReader) record(off int64, size int) {
+	var logical int64
+	if n := len(r.frames); n > 0 {
+		last := r.frames[n-1]
+		if off <= last.off {
+			return
+		}
+		logical = last.end()
+	}
+	r.frames = append(r.frames, frameLoc{off: off, logical: logical, size: size})
+}
+
+// total returns the size of the logical payload, if the end of the stream
+// has been seen.
+func (r *ConReader) total() int64 {
+	if n := len(r.frames); n > 0 {
+		return r.frames[n-1].end()
+	}
+	return 0
+}
+
+// Seek implements io.Seeker over the logical payload of the stream, if the
+// underlying reader is an io.Seeker, such as os.File.  The first Seek
+// scans the headers of the frames read so far from the start of the stream.
+// From then on, the frame locations are remembered as the stream is read, so
+// seeking backwards, or to the part of the stream that has been read, does
+// not read the frame headers again.  The reader that is never seeked does
+// not remember the frames.  Seeking forwards skips the frame payloads without reading them.
+// Seeking relative to the end scans the frame headers up to the closed
+// header.  After Seek, the size hint and the checksum trailer are no longer
+// verified.  Seek returns ErrNotSeekable if the underlying reader is not
+// seekable, or if the stream is compressed, or the reader prefetches the
+// frames or sends the acknowledgement.  After an error, the position is
+// undefined.
+func (r *ConReader) Seek(offset int64, whence int) (int64, error) {
+	if r.seeker == nil || r.prefetch > 0 || r.codec != nil || r.ack != nil {
+		return 0, ErrNotSeekable
+	}
+	if !r.seeked {
+		if err := r.scanRead(); err != nil {
+			return 0, err
+		}
+		r.seeked = true
+	}
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = r.n + offset
+	case io.SeekEnd:
+		if err := r.seekTo(math.MaxInt64); err != nil {
+			return 0, err
+		}
+		target = r.total() + offset
+	default:
+		return 0, errors.New("conio.ConReader.Seek: invalid whence")
+	}
+	if target < 0 {
+		return 0, errors.New("conio.ConReader.Seek: negative position")
+	}
+	if err := r.seekTo(target); err != nil {
+		return 0, err
+	}
+	return target, nil
+}
+
+// scanRead records the locations of the data frames read before the first
+// Seek, by scanning their headers from the start of the stream.
+func (r *ConReader) scanRead() error {
+	end := r.wire
+	if err := r.seekWire(0); err != nil {
+		return err
+	}
+	for r.wire < end {
+		hdr, err := readHeader(r.r)
+		if err != nil {
+			return unexpected(err)
+		}
+		off := r.wire
+		r.wire += hdrSz + int64(hdr.Size())
+		if !hdr.IsClosed() && hdr.Size() > 0 {
+			r.record(off, hdr.Size())
+		}
+		if _, err := r.seeker.Seek(int64(hdr.Size()), io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seekTo positions the reader at the logical offset t.
+func (r *ConReader) seekTo(t int64) error {
+	// the trailer will be read again, if the reader reaches it.
+	r.trailer = nil
+	i := sort.Search(len(r.frames), func(i int) bool { return r.frames[i].end() > t })
+	if i < len(r.frames) {
+		return r.position(r.frames[i], t)
+	}
+	if r.ended {
+		r.eof, r.unread, r.n = true, 0, t
+		return nil
+	}
+
+	// scan the frames that follow the last known frame.
+	start := r.wire
+	if n := len(r.frames); n > 0 {
+		last := r.frames[n-1]
+		start = last.off + hdrSz + int64(last.size)
+	}
+	if err := r.seekWire(start); err != nil {
+		return err
+	}
+	r.unread, r.eof = 0, false
+	for {
+		size, err := r.nextFrame()
+		if err == io.EOF {
+			r.eof, r.n = true, t
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if r.codec != nil {
+			return ErrNotSeekable
+		}
+		if size == 0 {
+			continue
+		}
+		if f := r.frames[len(r.frames)-1]; t < f.end() {
+			return r.position(f, t)
+		}
+		if _, err := r.seeker.Seek(int64(size), io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+}
+
+// position positions the reader at the logical offset t within the frame f.
+func (r *ConReader) position(f frameLoc, t int64) error {
+	skip := t - f.logical
+	if err := r.seekWire(f.off + hdrSz + skip); err != nil {
+		return err
+	}
+	r.wire = f.off + hdrSz + int64(f.size)
+	r.unread = f.size - int(skip)
+	r.frame = f.size
+	r.n = t
+	r.eof = false
+	return nil
+}
+
+// seekWire seeks the underlying reader to the offset off from the stream
+// start.
+func (r *ConReader) seekWire(off int64) error {
+	_, err := r.seeker.Seek(r.base+off, io.SeekStart)
+	r.wire = off
+	r.nhdr, r.ctl, r.part, r.peeked = 0, nil, nil, nil
+	return err
+}
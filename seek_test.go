@@ -0,0 +1,139 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestConReader_Seek(t *testing.T) {
+	data := testText(3000)
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"with controls", []Option{WithSizeHint(3000), WithChecksum()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeStream(t, NewWriter(&buf, tt.opts...), randomFrames(data)...)
+			if err := iotest.TestReader(NewReader(bytes.NewReader(buf.Bytes())), data); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestConReader_SeekFile(t *testing.T) {
+	// the stream starts in the middle of the file, and is followed by other
+	// data.
+	data := testText(2000)
+	prefix, suffix := []byte("prefix"), []byte("suffix")
+	name := filepath.Join(t.TempDir(), "stream.bin")
+	content := bytes.NewBuffer(append([]byte(nil), prefix...))
+	writeStream(t, NewWriter(content), randomFrames(data)...)
+	content.Write(suffix)
+	if err := ioutil.WriteFile(name, content.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(int64(len(prefix)), io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(f)
+
+	// read some, jump to the end, and back.
+	buf := make([]byte, 150)
+	if _, err := io.ReadFull(r, buf); err != nil || !bytes.Equal(buf, data[:150]) {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if pos, err := r.Seek(-100, io.SeekEnd); err != nil || pos != 1900 {
+		t.Fatalf("Seek(-100, end) = %d, %v", pos, err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, data[1900:]) {
+		t.Fatalf("ReadAll() = %q, %v", got, err)
+	}
+	if pos, err := r.Seek(100, io.SeekStart); err != nil || pos != 100 {
+		t.Fatalf("Seek(100, start) = %d, %v", pos, err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, data[100:]) {
+		t.Fatalf("ReadAll() = %d bytes, %v", len(got), err)
+	}
+	// the file is positioned after the closed header.
+	rest, _ := ioutil.ReadAll(f)
+	if !bytes.Equal(rest, suffix) {
+		t.Errorf("data after the stream = %q, want %q", rest, suffix)
+	}
+}
+
+func TestConReader_SeekRecord(t *testing.T) {
+	data := testText(3000)
+	var buf bytes.Buffer
+	writeStream(t, NewWriter(&buf, WithSizeHint(3000)), randomFrames(data)...)
+	stream := buf.Bytes()
+
+	// the reader that is never seeked does not record the frames.
+	r := NewReader(bytes.NewReader(stream))
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("ReadAll() = %d bytes, %v", len(got), err)
+	}
+	if len(r.frames) != 0 {
+		t.Errorf("frames recorded without Seek = %d", len(r.frames))
+	}
+	if pos, err := r.Seek(-10, io.SeekEnd); err != nil || pos != 2990 {
+		t.Fatalf("Seek(-10, end) after ReadAll = %d, %v", pos, err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, data[2990:]) {
+		t.Fatalf("ReadAll() = %q, %v", got, err)
+	}
+
+	// the first Seek finds the frames read before it.
+	r = NewReader(bytes.NewReader(stream))
+	if _, err := io.ReadFull(r, make([]byte, 1500)); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if pos, err := r.Seek(-1000, io.SeekCurrent); err != nil || pos != 500 {
+		t.Fatalf("Seek(-1000, current) = %d, %v", pos, err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, data[500:]) {
+		t.Fatalf("ReadAll() = %d bytes, %v", len(got), err)
+	}
+	if pos, err := r.Seek(-10, io.SeekEnd); err != nil || pos != 2990 {
+		t.Fatalf("Seek(-10, end) = %d, %v", pos, err)
+	}
+}
+
+func TestConReader_SeekErrors(t *testing.T) {
+	data := testText(1000)
+	var plain, compressed bytes.Buffer
+	writeStream(t, NewWriter(&plain), randomFrames(data)...)
+	writeStream(t, NewWriter(&compressed, WithCompression(flate.BestSpeed)), randomFrames(data)...)
+	tests := []struct {
+		name string
+		r    *ConReader
+	}{
+		{"not seeker", NewReader(iotest.OneByteReader(bytes.NewReader(plain.Bytes())))},
+		{"compressed", NewReader(bytes.NewReader(compressed.Bytes()))},
+		{"prefetch", NewReader(bytes.NewReader(plain.Bytes()), WithPrefetch(2, 0))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.r.Close()
+			if _, err := tt.r.Seek(10, io.SeekStart); !errors.Is(err, ErrNotSeekable) {
+				t.Errorf("ConReader.Seek() error = %v, want %v", err, ErrNotSeekable)
+			}
+		})
+	}
+}
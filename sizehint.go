@@ -0,0 +1,88 @@
+package conio
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+var (
+	// ErrShortStream is returned if the stream is closed before the size
+	// declared with WithSizeHint is transferred.
+	ErrShortStream = errors.New("stream is shorter than declared")
+	// ErrStreamTooLong is returned if the stream exceeds the size declared
+	// with WithSizeHint.
+	ErrStreamTooLong = errors.New("stream is longer than declared")
+)
+
+// sizeHintFrame returns the serialised size hint control frame.
+func sizeHintFrame(n int64) []byte {
+	var body [8]byte
+	endianness.PutUint64(body[:], uint64(n))
+	return ctlFrame(ctlSizeHint, body[:])
+}
+
+// loadSizeHint loads the size hint from the control frame body.
+func loadSizeHint(p []byte) (int64, error) {
+	if len(p) != 8 {
+		return 0, fmt.Errorf("%w: size hint", errInvalidControl)
+	}
+	n := int64(endianness.Uint64(p))
+	if n < 0 {
+		return 0, fmt.Errorf("%w: size hint %d", errInvalidControl, n)
+	}
+	return n, nil
+}
+
+// ExpectedSize returns the total size of the stream data declared by the
+// writer (see WithSizeHint), or -1 if it is unknown.  The size hint is sent
+// at the start of the stream, so it is known after the first Read.  It is
+// safe to call ExpectedSize concurrently with Read.
+func (r *ConReader) ExpectedSize() int64 {
+	return atomic.LoadInt64(&r.hint) - 1
+}
+
+// setExpectedSize sets the expected size of the stream.
+func (r *ConReader) setExpectedSize(n int64) {
+	atomic.StoreInt64(&r.hint, n+1)
+}
+
+// checkSize returns ErrStreamTooLong if receiving the next n bytes would
+// exceed the expected size of the stream.
+func (r *ConReader) checkSize(n int) error {
+	if exp := r.ExpectedSize(); exp >= 0 && r.n+int64(n) > exp {
+		return fmt.Errorf("%w: expected %d bytes", ErrStreamTooLong, exp)
+	}
+	return nil
+}
+
+// checkShort returns ErrShortStream if the data received is less than the
+// expected size of the stream.
+func (r *ConReader) checkShort() error {
+	if exp := r.ExpectedSize(); exp >= 0 && r.n < exp {
+		return fmt.Errorf("%w: received %d of %d bytes", ErrShortStream, r.n, exp)
+	}
+	return nil
+}
+
+// reserve accounts for n bytes to be written against the size hint.  It
+// returns ErrStreamTooLong if the size hint would be exceeded.
+func (w *ConWriter) reserve(n int) error {
+	if !w.hinted {
+		return nil
+	}
+	if atomic.AddInt64(&w.reserved, int64(n)) > w.hint {
+		atomic.AddInt64(&w.reserved, -int64(n))
+		return fmt.Errorf("%w: declared %d bytes", ErrStreamTooLong, w.hint)
+	}
+	return nil
+}
+
+// checkShort returns ErrShortStream if the data written is less than the
+// size hint.
+func (w *ConWriter) checkShort() error {
+	if w.hinted && w.n < w.hint {
+		return fmt.Errorf("%w: sent %d of %d bytes", ErrShortStream, w.n, w.hint)
+	}
+	return nil
+}
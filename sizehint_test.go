@@ -0,0 +1,122 @@
+package conio
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+
+	"io/ioutil"
+	"testing"
+)
+
+func TestWithSizeHint(t *testing.T) {
+	data := []byte("0123456789")
+	tests := []struct {
+		name         string
+		opts         []Option
+		hint         int64
+		writes       [][]byte
+		wantWriteErr error
+		wantCloseErr error
+		wantReadErr  error
+	}{
+		{"exact", nil, 10, [][]byte{data[:4], data[4:]}, nil, nil, nil},
+		{"exact compressed", []Option{WithCompression(flate.BestSpeed)}, 10, [][]byte{data[:4], data[4:]}, nil, nil, nil},
+		{"empty", nil, 0, nil, nil, nil, nil},
+		{"short", nil, 20, [][]byte{data}, nil, ErrShortStream, ErrShortStream},
+		{"short compressed", []Option{WithCompression(flate.BestSpeed)}, 20, [][]byte{data}, nil, ErrShortStream, ErrShortStream},
+		{"too long", nil, 5, [][]byte{data[:4], data[4:]}, ErrStreamTooLong, ErrShortStream, ErrShortStream},
+		{"too long compressed", []Option{WithCompression(flate.BestSpeed)}, 5, [][]byte{data[:4], data[4:]}, ErrStreamTooLong, ErrShortStream, ErrShortStream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, append(tt.opts, WithSizeHint(tt.hint))...)
+			var writeErr error
+			for _, p := range tt.writes {
+				if _, err := w.Write(p); err != nil {
+					writeErr = err
+				}
+			}
+			if !errors.Is(writeErr, tt.wantWriteErr) {
+				t.Errorf("ConWriter.Write() error = %v, want %v", writeErr, tt.wantWriteErr)
+			}
+			if err := w.Close(); !errors.Is(err, tt.wantCloseErr) {
+				t.Errorf("ConWriter.Close() error = %v, want %v", err, tt.wantCloseErr)
+			}
+
+			r := NewReader(&buf)
+			defer r.Close()
+			if got := r.ExpectedSize(); got != -1 {
+				t.Errorf("ConReader.ExpectedSize() before Read = %d, want -1", got)
+			}
+			_, err := ioutil.ReadAll(r)
+			if !errors.Is(err, tt.wantReadErr) {
+				t.Errorf("ConReader.Read() error = %v, want %v", err, tt.wantReadErr)
+			}
+			if got := r.ExpectedSize(); got != tt.hint {
+				t.Errorf("ConReader.ExpectedSize() = %d, want %d", got, tt.hint)
+			}
+		})
+	}
+}
+
+func TestConReader_tooLong(t *testing.T) {
+	// the writer that has not declared the size can not exceed it, so the
+	// hint is inserted manually.
+	stream := func(hint int64, frames ...[]byte) []byte {
+		buf := sizeHintFrame(hint)
+		for _, f := range frames {
+			buf = append(buf, must(newBinHeader(len(f), false)).Bytes()...)
+			buf = append(buf, f...)
+		}
+		return append(buf, must(newBinHeader(0, true)).Bytes()...)
+	}
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantN   int
+		wantErr error
+	}{
+		{"sync", nil, 4, ErrStreamTooLong},
+		{"prefetch", []Option{WithPrefetch(2, 0)}, 4, ErrStreamTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(bytes.NewReader(stream(5, []byte("0123"), []byte("4567"))), tt.opts...)
+			defer r.Close()
+			got, err := ioutil.ReadAll(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ConReader.Read() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(got) != tt.wantN {
+				t.Errorf("ConReader.Read() = %d bytes, want %d", len(got), tt.wantN)
+			}
+		})
+	}
+}
+
+func Test_loadSizeHint(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       []byte
+		want    int64
+		wantErr bool
+	}{
+		{"ok", []byte{1, 2, 0, 0, 0, 0, 0, 0}, 0x201, false},
+		{"short", []byte{1, 2, 0, 0}, 0, true},
+		{"negative", []byte{0, 0, 0, 0, 0, 0, 0, 0x80}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadSizeHint(tt.p)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadSizeHint() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("loadSizeHint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
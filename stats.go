@@ -0,0 +1,118 @@
+package conio
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats is the statistics of the stream.
+type Stats struct {
+	Frames     int64 // number of data frames
+	Heartbeats int64 // number of heartbeat frames
+	Controls   int64 // number of control frames
+
+	PayloadBytes int64 // size of the data frame payloads
+	HeaderBytes  int64 // size of all frame headers, including the closed header
+	ControlBytes int64 // size of the control frame payloads
+
+	MinFrame int // smallest data frame payload
+	MaxFrame int // largest data frame payload
+
+	First time.Time // time of the first data frame
+	Last  time.Time // time of the last data frame
+
+	Closed bool // the closed header has been sent or received
+}
+
+// MeanFrame returns the mean size of the data frame payload.
+func (s Stats) MeanFrame() float64 {
+	if s.Frames == 0 {
+		return 0
+	}
+	return float64(s.PayloadBytes) / float64(s.Frames)
+}
+
+// Overhead returns the number of bytes transferred in addition to the data
+// frame payloads.
+func (s Stats) Overhead() int64 {
+	return s.HeaderBytes + s.ControlBytes
+}
+
+// statsCollector collects the stream statistics.  It is safe for
+// concurrent use.
+type statsCollector struct {
+	mu sync.Mutex
+	s  Stats
+}
+
+// data records the data frame with the payload of the given size.
+func (c *statsCollector) data(size int) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.s.Frames == 0 {
+		c.s.First = now
+		c.s.MinFrame = size
+	}
+	c.s.Last = now
+	c.s.Frames++
+	c.s.PayloadBytes += int64(size)
+	c.s.HeaderBytes += hdrSz
+	if size < c.s.MinFrame {
+		c.s.MinFrame = size
+	}
+	if size > c.s.MaxFrame {
+		c.s.MaxFrame = size
+	}
+}
+
+// heartbeat records the heartbeat frame.
+func (c *statsCollector) heartbeat() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.s.Heartbeats++
+	c.s.HeaderBytes += hdrSz
+}
+
+// control records the control frame with the payload of the given size.
+func (c *statsCollector) control(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.s.Controls++
+	c.s.HeaderBytes += hdrSz
+	c.s.ControlBytes += int64(size)
+}
+
+// closed records the closed header.
+func (c *statsCollector) closed() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.s.Closed = true
+	c.s.HeaderBytes += hdrSz
+}
+
+// reset clears the statistics.
+func (c *statsCollector) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.s = Stats{}
+}
+
+// get returns the snapshot of the statistics.
+func (c *statsCollector) get() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.s
+}
+
+// Stats returns the statistics of the frames received so far.  It is safe
+// to call Stats concurrently with Read.
+func (r *ConReader) Stats() Stats {
+	return r.stats.get()
+}
+
+// Stats returns the statistics of the frames written so far.  It is safe to
+// call Stats concurrently with Write.
+func (w *ConWriter) Stats() Stats {
+	return w.stats.get()
+}
@@ -0,0 +1,71 @@
+package conio
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithSizeHint(16))
+	if got := w.Stats(); got.Frames != 0 || got.Closed {
+		t.Errorf("ConWriter.Stats() before Write = %+v", got)
+	}
+	start := time.Now()
+	for _, sz := range []int{2, 10, 4} {
+		if _, err := w.Write(make([]byte, sz)); err != nil {
+			t.Fatalf("ConWriter.Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ConWriter.Close() error = %v", err)
+	}
+	// inject a heartbeat before the closed header.
+	stream := buf.Bytes()
+	stream = append(append(stream[:len(stream)-hdrSz:len(stream)-hdrSz], 0, 0, 0, 0), 0, 0, 0, 0x80)
+
+	r := NewReader(bytes.NewReader(stream))
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatalf("ConReader.Read() error = %v", err)
+	}
+
+	want := Stats{
+		Frames:       3,
+		Controls:     1,
+		PayloadBytes: 16,
+		HeaderBytes:  5 * hdrSz,
+		ControlBytes: 9,
+		MinFrame:     2,
+		MaxFrame:     10,
+		Closed:       true,
+	}
+	check := func(name string, got Stats, want Stats) {
+		t.Helper()
+		if got.First.Before(start) || got.Last.Before(got.First) {
+			t.Errorf("%s: First = %v, Last = %v, start %v", name, got.First, got.Last, start)
+		}
+		got.First, got.Last = time.Time{}, time.Time{}
+		if got != want {
+			t.Errorf("%s = %+v, want %+v", name, got, want)
+		}
+	}
+	check("ConWriter.Stats()", w.Stats(), want)
+	want.Heartbeats++
+	want.HeaderBytes += hdrSz
+	check("ConReader.Stats()", r.Stats(), want)
+
+	if got, want := r.Stats().MeanFrame(), 16.0/3; got != want {
+		t.Errorf("Stats.MeanFrame() = %v, want %v", got, want)
+	}
+	if got, want := r.Stats().Overhead(), int64(6*hdrSz+9); got != want {
+		t.Errorf("Stats.Overhead() = %v, want %v", got, want)
+	}
+}
+
+func TestStats_MeanFrame(t *testing.T) {
+	if got := (Stats{}).MeanFrame(); got != 0 {
+		t.Errorf("Stats.MeanFrame() = %v, want 0", got)
+	}
+}
@@ -0,0 +1,95 @@
+package conio
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// WithLogger makes the ConReader or ConWriter log each frame header it
+// decodes or encodes, and each error returned by Read, Write or Close, to l
+// at slog.LevelDebug.  The frame records carry the direction, the frame
+// index and offset in the stream, the payload size, the closed flag, the
+// frame type and, for control frames, the control kind.  Nil l disables
+// logging, which is the default.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// frame types, as logged.
+const (
+	typData      = "data"
+	typHeartbeat = "heartbeat"
+	typControl   = "control"
+	typClosed    = "closed"
+)
+
+// tracer logs the frames of one stream.  It is safe for concurrent use.
+type tracer struct {
+	log *slog.Logger
+	dir string
+
+	mu  sync.Mutex
+	idx int64 // index of the next frame
+	off int64 // offset of the next frame header
+}
+
+func newTracer(l *slog.Logger, dir Direction) *tracer {
+	if l == nil {
+		return nil
+	}
+	t := &tracer{log: l, dir: "read"}
+	if dir == DirWrite {
+		t.dir = "write"
+	}
+	return t
+}
+
+// frame logs the frame header with the given payload size and closed flag.
+// kind is the control frame kind, and is ignored for other frames.
+func (t *tracer) frame(size int, closed bool, kind byte) {
+	t.mu.Lock()
+	idx, off := t.idx, t.off
+	t.idx++
+	t.off += hdrSz + int64(size)
+	t.mu.Unlock()
+	if !t.log.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("dir", t.dir),
+		slog.Int64("index", idx),
+		slog.Int64("offset", off),
+		slog.Int("size", size),
+		slog.Bool("closed", closed),
+	}
+	switch {
+	case closed && size == 0:
+		attrs = append(attrs, slog.String("type", typClosed))
+	case closed:
+		attrs = append(attrs, slog.String("type", typControl), slog.Int("kind", int(kind)))
+	case size == 0:
+		attrs = append(attrs, slog.String("type", typHeartbeat))
+	default:
+		attrs = append(attrs, slog.String("type", typData))
+	}
+	t.log.LogAttrs(context.Background(), slog.LevelDebug, "conio frame", attrs...)
+}
+
+// error logs the error err.  The index and offset in the record are those
+// that follow the last frame logged, so the error occurred either in the
+// payload of that frame, or in the header at the offset.
+func (t *tracer) error(err error) {
+	t.mu.Lock()
+	idx, off := t.idx, t.off
+	t.mu.Unlock()
+	t.log.LogAttrs(context.Background(), slog.LevelDebug, "conio error",
+		slog.String("dir", t.dir),
+		slog.Int64("index", idx),
+		slog.Int64("offset", off),
+		slog.String("kind", ErrorKind(err)),
+		slog.Any("error", err),
+	)
+}
@@ -0,0 +1,91 @@
+package conio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recHandler is the slog.Handler that records the messages with attributes
+// in the compact form.
+type recHandler struct {
+	level   slog.Level
+	mu      sync.Mutex
+	records []string
+}
+
+func (h *recHandler) Enabled(_ context.Context, l slog.Level) bool { return l >= h.level }
+func (h *recHandler) WithAttrs([]slog.Attr) slog.Handler           { return h }
+func (h *recHandler) WithGroup(string) slog.Handler                { return h }
+
+func (h *recHandler) Handle(_ context.Context, r slog.Record) error {
+	var sb strings.Builder
+	sb.WriteString(r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key != "error" {
+			fmt.Fprintf(&sb, " %s=%v", a.Key, a.Value)
+		}
+		return true
+	})
+	h.mu.Lock()
+	h.records = append(h.records, sb.String())
+	h.mu.Unlock()
+	return nil
+}
+
+func TestWithLogger(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		wh  = &recHandler{level: slog.LevelDebug}
+		rh  = &recHandler{level: slog.LevelDebug}
+	)
+	w := NewWriter(&buf, WithLogger(slog.New(wh)), WithSizeHint(8))
+	w.Write([]byte{1, 2, 3})
+	w.Write([]byte{4, 5, 6, 7, 8})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wantW := []string{
+		"conio frame dir=write index=0 offset=0 size=9 closed=true type=control kind=3",
+		"conio frame dir=write index=1 offset=13 size=3 closed=false type=data",
+		"conio frame dir=write index=2 offset=20 size=5 closed=false type=data",
+		"conio frame dir=write index=3 offset=29 size=0 closed=true type=closed",
+	}
+	if !reflect.DeepEqual(wh.records, wantW) {
+		t.Errorf("writer records = %q, want %q", wh.records, wantW)
+	}
+
+	// corrupt the second data frame header, so that its size exceeds the hint.
+	data := buf.Bytes()
+	data[20] = 6
+	r := NewReader(bytes.NewReader(data), WithLogger(slog.New(rh)))
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Fatal("expected an error")
+	}
+	wantR := []string{
+		"conio frame dir=read index=0 offset=0 size=9 closed=true type=control kind=3",
+		"conio frame dir=read index=1 offset=13 size=3 closed=false type=data",
+		"conio frame dir=read index=2 offset=20 size=6 closed=false type=data",
+		"conio error dir=read index=3 offset=30 kind=too_long",
+	}
+	if !reflect.DeepEqual(rh.records, wantR) {
+		t.Errorf("reader records = %q, want %q", rh.records, wantR)
+	}
+}
+
+func TestWithLogger_disabled(t *testing.T) {
+	h := &recHandler{level: slog.LevelInfo}
+	w := NewWriter(ioutil.Discard, WithLogger(slog.New(h)))
+	io.WriteString(w, "data")
+	w.Close()
+	if len(h.records) != 0 {
+		t.Errorf("records = %q, want none", h.records)
+	}
+}